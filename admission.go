@@ -0,0 +1,100 @@
+package arch
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// This error is produced when a call to the model is rejected because the maximum number of calls in flight was
+// reached, services can use it to shed load upstream
+var ErrOverloaded = errors.New("model overloaded")
+
+// What a call does when the maximum number of calls in flight was reached
+type AdmissionPolicy int
+
+const (
+	// The call waits until another call finishes or the model is stopped, then it's rejected with ErrOverloaded
+	AdmitBlock AdmissionPolicy = iota
+	// The call is rejected with ErrOverloaded
+	AdmitFailFast
+	// The call waits until another call finishes for the timeout of the admission or until the model is stopped,
+	// then it's rejected with ErrOverloaded
+	AdmitWait
+)
+
+// Limits the calls to a model that are waiting for their outputs
+type Admission struct {
+	MaxInFlight int             //Maximum calls in flight, zero or lesser means no limit
+	Policy      AdmissionPolicy //What a call does when the maximum is reached
+	Timeout     time.Duration   //Maximum time a call waits with AdmitWait policy
+}
+
+type admission struct {
+	Admission
+	slots    chan int
+	rejected atomic.Int64
+}
+
+// Set the admission control of calls to the model, it must be called before the first call.
+//
+// Call makes panic with ErrOverloaded when admission control rejects a call, models with AdmitFailFast or AdmitWait
+// policies must be called with TryCall. Every policy rejects the calls waiting for a slot when the model is stopped.
+func (md *model) SetAdmission(adm Admission) {
+	if adm.MaxInFlight <= 0 {
+		md.admission = nil
+		return
+	}
+	md.admission = &admission{Admission: adm, slots: make(chan int, adm.MaxInFlight)}
+}
+
+// Calls rejected by admission control
+func (md *model) Rejected() int64 {
+	if md.admission == nil {
+		return 0
+	}
+	return md.admission.rejected.Load()
+}
+
+// Take a slot for a call following the policy, it's false if the call is rejected or quit is closed while the call
+// waits
+func (adm *admission) admit(quit chan int) bool {
+	if adm == nil {
+		return true
+	}
+	admitted := false
+	switch adm.Policy {
+	case AdmitFailFast:
+		select {
+		case adm.slots <- 0:
+			admitted = true
+		default:
+		}
+	case AdmitWait:
+		timeout := time.NewTimer(adm.Timeout)
+		defer timeout.Stop()
+		select {
+		case adm.slots <- 0:
+			admitted = true
+		case <-timeout.C:
+		case <-quit:
+		}
+	default:
+		select {
+		case adm.slots <- 0:
+			admitted = true
+		case <-quit:
+		}
+	}
+	if !admitted {
+		adm.rejected.Add(1)
+	}
+	return admitted
+}
+
+// Free the slot of a call that got its outputs
+func (adm *admission) leave() {
+	if adm != nil {
+		<-adm.slots
+	}
+}
@@ -0,0 +1,114 @@
+package arch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Model with a filter that admits one call in flight, the filter tells when it receives a call through started
+// and waits for release to return it
+func admissionModel(policy AdmissionPolicy, timeout time.Duration) (model Model, started, release chan int) {
+	in := NewPipe("in", int(0), 10)
+	out := NewPipe("out", int(0), 10)
+	started, release = make(chan int, 10), make(chan int)
+	slow := NewFilterWithPipes("slow", func(n int) int {
+		started <- n
+		<-release
+		return n + 1
+	}, WithPipes(in), WithPipes(out), WithLens())
+	model = NewModel(WithFilters(slow), WithPipes(in), WithPipes(out))
+	model.SetAdmission(Admission{MaxInFlight: 1, Policy: policy, Timeout: timeout})
+	return model, started, release
+}
+
+func TestAdmitFailFast(t *testing.T) {
+	model, started, release := admissionModel(AdmitFailFast, 0)
+	model.Run()
+	defer model.Stop()
+	done := make(chan []any)
+	go func() {
+		done <- model.Call(WithInput(1))
+	}()
+	<-started
+	if _, err := model.TryCall(WithInput(2)); !errors.Is(err, ErrOverloaded) {
+		t.Fatal("call must be rejected while another one is in flight", err)
+	}
+	close(release)
+	if output := <-done; output[0] != 2 {
+		t.Fatal(output)
+	}
+	if output, err := model.TryCall(WithInput(3)); err != nil || output[0] != 4 {
+		t.Fatal("call must be admitted when the previous one finished", output, err)
+	}
+	if model.Rejected() != 1 {
+		t.Fatal(model.Rejected())
+	}
+}
+
+func TestAdmitWait(t *testing.T) {
+	model, started, release := admissionModel(AdmitWait, time.Millisecond*10)
+	model.Run()
+	defer model.Stop()
+	done := make(chan []any)
+	go func() {
+		done <- model.Call(WithInput(1))
+	}()
+	<-started
+	start := time.Now()
+	if _, err := model.TryCall(WithInput(2)); !errors.Is(err, ErrOverloaded) {
+		t.Fatal("call must be rejected after the timeout", err)
+	}
+	if waited := time.Since(start); waited < time.Millisecond*10 {
+		t.Fatal("call must wait for the timeout", waited)
+	}
+	close(release)
+	<-done
+	if model.Rejected() != 1 {
+		t.Fatal(model.Rejected())
+	}
+}
+
+func TestAdmitBlock(t *testing.T) {
+	model, _, release := admissionModel(AdmitBlock, 0)
+	close(release)
+	model.Run()
+	defer model.Stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if output, err := model.TryCall(WithInput(i)); err != nil || output[0] != i+1 {
+				t.Error(i, output, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if model.Rejected() != 0 {
+		t.Fatal(model.Rejected())
+	}
+}
+
+func TestAdmitBlockStop(t *testing.T) {
+	model, started, release := admissionModel(AdmitBlock, 0)
+	defer close(release)
+	model.Run()
+	go model.TryCall(WithInput(1))
+	<-started
+	rejected := make(chan error)
+	go func() {
+		_, err := model.TryCall(WithInput(2))
+		rejected <- err
+	}()
+	model.Stop()
+	select {
+	case err := <-rejected:
+		if !errors.Is(err, ErrOverloaded) {
+			t.Fatal("call waiting for a slot must be rejected when the model is stopped", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("stop doesn't release calls waiting for a slot")
+	}
+}
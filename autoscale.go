@@ -0,0 +1,173 @@
+package arch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Minimum and maximum number of calls of a filter running at the same time
+type ScaleBounds struct {
+	Min, Max int
+}
+
+// Options of the autoscaler of a model
+type AutoscaleOptions struct {
+	Bounds   map[string]ScaleBounds //Bounds of every filter by name, filters without bounds use Default
+	Default  ScaleBounds            //Bounds of filters without their own, filters with Max lesser than 2 are not scaled
+	Interval time.Duration          //Time between decisions, zero uses DefaultAutoscaleInterval
+	Log      func(ScaleDecision)    //Called for every change of the number of workers of a filter, it could be nil
+}
+
+// Time between decisions of the autoscaler when Interval is zero
+const DefaultAutoscaleInterval = time.Millisecond * 100
+
+// Change of the number of workers of a filter, it tells what the autoscaler observed
+type ScaleDecision struct {
+	Filter  string
+	From    int           //Workers before the decision
+	To      int           //Workers after the decision
+	Depth   int           //Items waiting in the input buffers of the filter
+	Latency time.Duration //Mean time to process an item in the last interval
+	Reason  string
+}
+
+func (decision ScaleDecision) String() string {
+	return fmt.Sprintf("filter '%s' workers %d -> %d (depth %d, latency %s): %s", decision.Filter, decision.From, decision.To, decision.Depth, decision.Latency, decision.Reason)
+}
+
+// Scaled filter
+type scaled struct {
+	ftr       *filter
+	bounds    ScaleBounds
+	processed int64
+	busy      time.Duration
+}
+
+type autoscaler struct {
+	opts    AutoscaleOptions
+	filters []*scaled
+}
+
+// Grow or shrink the number of calls that every filter runs at the same time within its bounds. Filters with input
+// items waiting in their buffers while every worker is busy grow, and filters whose workers are idle shrink to the
+// mean concurrency they used (throughput by latency). With a model budget (SetBudget) the sum of workers of every
+// scaled filter doesn't exceed its workers and a filter doesn't grow past the maximum of its share. It must be
+// called before Run, source filters and filters with their own loop (windows, reducers and
+// joins) are not scaled.
+func (md *model) Autoscale(opts AutoscaleOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultAutoscaleInterval
+	}
+	as := &autoscaler{opts: opts}
+	for _, f := range md.filters {
+		ftr, ok := f.(*filter)
+		if !ok || ftr.IsSource() {
+			continue
+		}
+		bounds, ok := opts.Bounds[ftr.name]
+		if !ok {
+			bounds = opts.Default
+		}
+		if bounds.Min < 1 {
+			bounds.Min = 1
+		}
+		if bounds.Max < 2 || bounds.Max < bounds.Min {
+			continue
+		}
+		//Filters run in parallel mode with the maximum and the workers limit the calls running at the same time
+		ftr.parallel = bounds.Max
+		ftr.workers = newLimiter(bounds.Min)
+		as.filters = append(as.filters, &scaled{ftr: ftr, bounds: bounds})
+	}
+	md.autoscaler = as
+}
+
+// Items waiting in the input buffers of filter
+func (ftr *filter) depth() int {
+	depth := 0
+	ftr.input.ForEach(func(pipe Pipe) bool {
+		if n := len(itemsOf(pipe).channel(ftr)); n > depth {
+			depth = n
+		}
+		return true
+	})
+	return depth
+}
+
+// Make decisions every interval until the model is stopped or every filter is finished
+func (md *model) autoscale(as *autoscaler) {
+	tick := time.NewTicker(as.opts.Interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-md.quit:
+			return
+		case <-md.singal.(*signal).done:
+			return
+		case <-tick.C:
+			as.decide(md.budget.Workers)
+		}
+	}
+}
+
+// Decide the workers of every filter, filters with deeper buffers are decided first so they take the budget,
+// a budget of zero or lesser workers means no limit
+func (as *autoscaler) decide(budget int) {
+	type observed struct {
+		*scaled
+		depth    int
+		inFlight int64
+		latency  time.Duration
+		busy     time.Duration
+	}
+	all := make([]observed, 0, len(as.filters))
+	for _, sc := range as.filters {
+		stats := sc.ftr.counters.snapshot()
+		processed, busy := stats.Processed-sc.processed, stats.Busy-sc.busy
+		sc.processed, sc.busy = stats.Processed, stats.Busy
+		obs := observed{scaled: sc, depth: sc.ftr.depth(), inFlight: stats.InFlight, busy: busy}
+		if processed > 0 {
+			obs.latency = busy / time.Duration(processed)
+		}
+		all = append(all, obs)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].depth > all[j].depth })
+	used := 0
+	for _, obs := range all {
+		used += obs.ftr.workers.size()
+	}
+	for _, obs := range all {
+		current := obs.ftr.workers.size()
+		want, reason := current, ""
+		//Mean calls running at the same time in the last interval, it's the throughput by latency
+		concurrency := int(math.Ceil(float64(obs.busy) / float64(as.opts.Interval)))
+		switch {
+		case obs.depth > 0 && obs.inFlight >= int64(current):
+			want, reason = current+1, "items are waiting and every worker is busy"
+		case obs.depth == 0 && obs.inFlight < int64(current) && concurrency < current:
+			want, reason = current-1, fmt.Sprintf("workers are idle, mean concurrency is %d", concurrency)
+		}
+		if want < obs.bounds.Min {
+			want = obs.bounds.Min
+		}
+		if want > obs.bounds.Max {
+			want = obs.bounds.Max
+		}
+		if sh := obs.ftr.share; sh != nil && sh.max > 0 && want > current && want > sh.max {
+			want = current
+		}
+		if budget > 0 && want > current && used+want-current > budget {
+			want = current
+		}
+		if want == current {
+			continue
+		}
+		used += want - current
+		obs.ftr.workers.resize(want)
+		if as.opts.Log != nil {
+			as.opts.Log(ScaleDecision{Filter: obs.ftr.name, From: current, To: want, Depth: obs.depth, Latency: obs.latency, Reason: reason})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package arch
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAutoscale(t *testing.T) {
+	in := NewPipe("in", int(0), 10)
+	mid := NewPipe("mid", int(0), 10)
+	out := NewPipe("out", int(0), 10)
+	first := NewFilterWithPipes("first", func(n int) int {
+		time.Sleep(time.Millisecond * 5)
+		return n + 1
+	}, WithPipes(in), WithPipes(mid), WithLens())
+	second := NewFilterWithPipes("second", func(n int) int {
+		time.Sleep(time.Millisecond * 5)
+		return n * 2
+	}, WithPipes(mid), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(first, second), WithPipes(in), WithPipes(out))
+	mtx := sync.Mutex{}
+	workers := map[string]int{"first": 1, "second": 1}
+	grown := 0
+	model.SetBudget(Budget{Workers: 5, Filters: map[string]Share{"second": {Max: 3}}})
+	model.Autoscale(AutoscaleOptions{
+		Default:  ScaleBounds{Min: 1, Max: 4},
+		Interval: time.Millisecond * 10,
+		Log: func(decision ScaleDecision) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			if decision.From != workers[decision.Filter] || decision.To < 1 || decision.To > 4 {
+				t.Error(decision)
+			}
+			workers[decision.Filter] = decision.To
+			if workers["first"]+workers["second"] > 5 || workers["second"] > 3 {
+				t.Error("budget exceeded", workers)
+			}
+			if decision.To > decision.From {
+				grown++
+			}
+		},
+	})
+	model.Run()
+	defer model.Stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if output := model.Call(WithInput(i)); output[0] != (i+1)*2 {
+				t.Error(i, output)
+			}
+		}(i)
+	}
+	wg.Wait()
+	mtx.Lock()
+	defer mtx.Unlock()
+	if grown == 0 {
+		t.Fatal("filters with waiting items must grow", workers)
+	}
+}
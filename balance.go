@@ -0,0 +1,151 @@
+package arch
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// Strategy used by a balanced pipe to choose the subscriber that receives an item
+type BalanceStrategy interface {
+	pick(data any, loads []int) int //Index of the subscriber for data, loads are the items queued for every subscriber
+}
+
+type roundRobin struct {
+	next int
+}
+
+// Items are sent to subscribers one after another
+func RoundRobin() BalanceStrategy {
+	return &roundRobin{}
+}
+
+func (rr *roundRobin) pick(data any, loads []int) int {
+	index := rr.next % len(loads)
+	rr.next++
+	return index
+}
+
+type leastLoaded struct{}
+
+// Items are sent to the subscriber with less queued items
+func LeastLoaded() BalanceStrategy {
+	return &leastLoaded{}
+}
+
+func (ll *leastLoaded) pick(data any, loads []int) int {
+	index := 0
+	for i := range loads {
+		if loads[i] < loads[index] {
+			index = i
+		}
+	}
+	return index
+}
+
+type keyHash struct {
+	key  func(data any) string
+	skip roundRobin
+}
+
+// Items with the same key are always sent to the same subscriber, skipped items are sent one after another
+func KeyHash(key func(data any) string) BalanceStrategy {
+	return &keyHash{key: key}
+}
+
+func (kh *keyHash) pick(data any, loads []int) int {
+	if data == nil {
+		return kh.skip.pick(data, loads)
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(kh.key(data)))
+	return int(hash.Sum32() % uint32(len(loads)))
+}
+
+// Pipe that sends every item to exactly one subscriber, it's used to share work between replicas of a filter
+type balancedPipe struct {
+	*pipe
+	strategy BalanceStrategy
+	key      func(data any) string //Key of partitioned pipes, nil for balanced pipes
+	subs     []Filter
+	ticket   uint64
+}
+
+// Create a pipe that works as a queue: every item goes to only one of the filters linked to it.
+//
+// Items are numbered in the order they are sent, so a merge pipe with MergeOrdered mode can reassemble
+// the results of the replicas in the same order for the next stage.
+func NewBalancedPipe(name string, checkType any, buffer int, strategy BalanceStrategy) Pipe {
+	return &balancedPipe{
+		pipe:     newPipe(name, checkType, buffer),
+		strategy: strategy,
+		subs:     make([]Filter, 0, 10),
+	}
+}
+
+// Link pipe to filter input
+func (bp *balancedPipe) To(filter Filter) error {
+	if err := bp.pipe.To(filter); err != nil {
+		return err
+	}
+	bp.subs = append(bp.subs, filter)
+	return nil
+}
+
+// Send data through pipe
+func (bp *balancedPipe) Set(data any) {
+	it := &item{data: data}
+	bp.send(it)
+	itemOut(&bp.hooks, "", bp, it)
+}
+
+// Send item to one subscriber
+func (bp *balancedPipe) send(it *item) {
+	bp.mtx.Lock()
+	defer bp.mtx.Unlock()
+	bp.check(it.data)
+	if len(bp.subs) == 0 {
+		return
+	}
+	loads := make([]int, len(bp.subs))
+	for i := range bp.subs {
+		loads[i] = len(bp.conn[bp.subs[i]])
+	}
+	bp.ticket++
+	sent := *it
+	sent.ticket = bp.ticket
+	sent.key = ""
+	if bp.key != nil && it.data != nil {
+		sent.key = bp.key(it.data)
+	}
+	start := time.Now()
+	blocked := deliver(bp.conn[bp.subs[bp.strategy.pick(it.data, loads)]], &sent)
+	bp.counters.sending(start, blocked)
+}
+
+// Header of an item received from pipe by a filter. Tickets are only valid for the replicas that receive items from
+// the balanced pipe that numbered them, so their results can be reassembled. Items from other pipes lose them, so a
+// later merge pipe in MergeOrdered mode doesn't wait for tickets of a balanced pipe that it doesn't reassemble.
+// Keys are only valid for the filters that receive items from a partitioned pipe, items from other pipes use the
+// empty key.
+func scoped(pipe Pipe, head header) header {
+	bp, ok := pipe.(*balancedPipe)
+	if !ok {
+		head.ticket = 0
+	}
+	if !ok || bp.key == nil {
+		head.key = ""
+	}
+	return head
+}
+
+// Create replicas of a filter, every replica runs the same function with the same pipes.
+//
+// Input pipes are usually balanced pipes and output pipes are merge pipes with MergeOrdered mode.
+func NewReplicas(name string, replicas int, fn any, ins, outs []Pipe, lens []Length) []Filter {
+	filters := make([]Filter, replicas)
+	for i := range filters {
+		filters[i] = NewFilterWithPipes(fmt.Sprintf("%s#%d", name, i), fn, ins, outs, lens)
+	}
+	return filters
+}
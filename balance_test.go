@@ -0,0 +1,109 @@
+package arch
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBalancedReplicas(t *testing.T) {
+	input := NewPipe("input", int(0), 1)
+	items := NewBalancedPipe("items", int(0), 2, RoundRobin())
+	squares := NewMergePipe("squares", int(0), 2, MergeOrdered)
+	output := NewPipe("output", []int{}, 1)
+
+	split := NewFilterWithPipes("split", func(n int) []int {
+		items := make([]int, n)
+		for i := range items {
+			items[i] = i
+		}
+		return items
+	},
+		WithPipes(input),
+		WithPipes(items),
+		WithLens(),
+	)
+	mtx := sync.Mutex{}
+	processed := map[int]bool{}
+	replicas := NewReplicas("square", 3, func(n int) int {
+		time.Sleep(time.Millisecond * time.Duration(rand.Intn(3)))
+		mtx.Lock()
+		defer mtx.Unlock()
+		if processed[n] {
+			panic(fmt.Errorf("item %d processed twice", n))
+		}
+		processed[n] = true
+		return n * n
+	},
+		WithPipes(items),
+		WithPipes(squares),
+		WithLens(),
+	)
+	join := NewFilterWithPipes("join", func(squares []int) []int {
+		return squares
+	},
+		WithPipes(squares),
+		WithPipes(output),
+		WithLens(NewLen(squares, items)),
+	)
+	model := NewModel(append(replicas, split, join), WithPipes(input), WithPipes(output))
+	model.Run()
+	result := model.Call(WithInput(20))[0].([]int)
+	model.Stop()
+	if len(result) != 20 {
+		t.Fatal(result)
+	}
+	for i := range result {
+		if result[i] != i*i {
+			t.Fatal(result)
+		}
+	}
+	if model.HasErrs() {
+		model.PrintErrs()
+		t.Fail()
+	}
+}
+
+func TestBalanceStrategies(t *testing.T) {
+	loads := []int{3, 1, 2}
+	if index := LeastLoaded().pick(nil, loads); index != 1 {
+		t.Fatal(index)
+	}
+	rr := RoundRobin()
+	for i := 0; i < 6; i++ {
+		if index := rr.pick(nil, loads); index != i%3 {
+			t.Fatal(index)
+		}
+	}
+	kh := KeyHash(func(data any) string { return fmt.Sprint(data.(int) % 10) })
+	for i := 0; i < 100; i++ {
+		if kh.pick(i, loads) != kh.pick(i%10, loads) {
+			t.Fatal("same key sent to different subscribers")
+		}
+	}
+}
+
+func TestTicketScope(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	ordered := NewMergePipe("ordered", int(0), 1, MergeOrdered)
+	inc := NewFilterWithPipes("inc", func(n int) int { return n + 1 }, WithPipes(in), WithPipes(ordered), WithLens())
+	ordered.To(nil)
+	sg := newSignal()
+	inc.SetSignal(sg)
+	go inc.Run()
+	defer sg.Stop()
+	//The ticket of a balanced pipe reassembled before must not reach the next merge pipe
+	itemsOf(in).send(&item{data: 1, header: header{seq: 1, ticket: 5}})
+	result := make(chan any)
+	go func() { result <- ordered.Get(nil) }()
+	select {
+	case n := <-result:
+		if n != 2 {
+			t.Fatal(n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("merge pipe waits for a ticket of another balanced pipe")
+	}
+}
@@ -0,0 +1,152 @@
+package arch
+
+import (
+	"sync"
+)
+
+// Workers shared by every filter of a model, function calls wait for a worker when every one is busy
+type Budget struct {
+	Workers int              //Function calls running at the same time in every filter of the model
+	Filters map[string]Share //Share of every filter by name, filters without share use Default
+	Default Share
+}
+
+// Share of the workers of a budget for a filter
+type Share struct {
+	Weight int //Relative share of the workers when filters wait for them, zero or lesser means 1
+	Max    int //Maximum workers of the filter, zero or lesser means no limit other than the budget
+}
+
+// Pass added for every worker granted to a filter with weight 1, filters with more weight advance slower
+const strideUnit = 1 << 20
+
+// Grants the workers of a budget with weighted fair scheduling (stride scheduling): the waiting filter with the
+// lowest pass gets the next worker and its pass advances inversely to its weight
+type scheduler struct {
+	mtx    sync.Mutex
+	free   int
+	pass   uint64 //Pass of the last grant, filters that were idle start from it
+	shares []*share
+}
+
+// Workers used by a filter
+type share struct {
+	sched   *scheduler
+	stride  uint64
+	pass    uint64
+	max     int
+	running int
+	waiting []chan int
+}
+
+func newScheduler(workers int) *scheduler {
+	return &scheduler{free: workers}
+}
+
+func (sched *scheduler) share(sh Share) *share {
+	if sh.Weight < 1 {
+		sh.Weight = 1
+	}
+	s := &share{sched: sched, stride: strideUnit / uint64(sh.Weight), max: sh.Max}
+	sched.shares = append(sched.shares, s)
+	return s
+}
+
+// Tell if share can take a worker now
+func (sh *share) ready() bool {
+	return sh.max <= 0 || sh.running < sh.max
+}
+
+// Take a worker, it must be called with lock
+func (sh *share) grant() {
+	sched := sh.sched
+	if sh.pass < sched.pass {
+		sh.pass = sched.pass //idle filters don't keep credit
+	}
+	sched.pass = sh.pass
+	sh.pass += sh.stride
+	sh.running++
+	sched.free--
+}
+
+// Wait for a worker, a nil share doesn't wait
+func (sh *share) acquire() {
+	if sh == nil {
+		return
+	}
+	sched := sh.sched
+	sched.mtx.Lock()
+	//Free workers are only left when every waiting filter is at its maximum
+	if sched.free > 0 && sh.ready() && len(sh.waiting) == 0 {
+		sh.grant()
+		sched.mtx.Unlock()
+		return
+	}
+	granted := make(chan int)
+	sh.waiting = append(sh.waiting, granted)
+	sched.mtx.Unlock()
+	<-granted
+}
+
+// Release a worker and grant free workers to the waiting filters with the lowest pass
+func (sh *share) release() {
+	if sh == nil {
+		return
+	}
+	sched := sh.sched
+	sched.mtx.Lock()
+	defer sched.mtx.Unlock()
+	sh.running--
+	sched.free++
+	for sched.free > 0 {
+		var next *share
+		for _, s := range sched.shares {
+			if len(s.waiting) > 0 && s.ready() && (next == nil || s.pass < next.pass) {
+				next = s
+			}
+		}
+		if next == nil {
+			return
+		}
+		granted := next.waiting[0]
+		next.waiting = next.waiting[1:]
+		next.grant()
+		close(granted)
+	}
+}
+
+// Share the workers of budget between every filter of the model, so a burst in a filter doesn't starve the others.
+// When filters wait for workers they are granted in proportion to their weights, and a filter never runs more
+// calls than its maximum. The autoscaler keeps the workers of scaled filters within the same budget. A budget
+// without workers removes the budget. It must be called before Run.
+//
+// Reducers take a worker for every fold step, joins for every call of their key functions and windows run no
+// function of their own. The filters of loop bodies share the budget with the names of stats, like "loop/filter",
+// and loop filters don't take a worker while their body runs, so their bodies don't wait for the workers they hold.
+// Filters with channel parameters don't take a worker either, their functions wait for the elements sent by the
+// filters that feed them.
+func (md *model) SetBudget(budget Budget) {
+	md.budget = budget
+	md.share(newScheduler(budget.Workers), budget, "")
+}
+
+// Set the shares of the filters of model and of the bodies of its loops, prefix is the path of the loops
+func (md *model) share(sched *scheduler, budget Budget, prefix string) {
+	for _, f := range md.filters {
+		ftr := baseOf(f)
+		if lp, ok := f.(*loop); ok {
+			ftr.share = nil
+			lp.body.(*model).share(sched, budget, prefix+ftr.name+"/")
+			continue
+		}
+		if budget.Workers <= 0 || ftr.streaming() {
+			ftr.share = nil
+			continue
+		}
+		sh, ok := budget.Filters[prefix+ftr.name]
+		if !ok {
+			sh = budget.Default
+		}
+		ftr.share = sched.share(sh)
+	}
+}
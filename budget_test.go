@@ -0,0 +1,190 @@
+package arch
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerWeights(t *testing.T) {
+	sched := newScheduler(1)
+	light := sched.share(Share{Weight: 1})
+	heavy := sched.share(Share{Weight: 3})
+	light.acquire()
+	mtx := sync.Mutex{}
+	order := make([]string, 0, 16)
+	wg := sync.WaitGroup{}
+	wait := func(sh *share, name string) {
+		defer wg.Done()
+		sh.acquire()
+		mtx.Lock()
+		order = append(order, name)
+		mtx.Unlock()
+		sh.release()
+	}
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go wait(light, "light")
+		go wait(heavy, "heavy")
+	}
+	//Every call must be waiting before the worker is released
+	for queued := 0; queued < 16; {
+		time.Sleep(time.Millisecond)
+		sched.mtx.Lock()
+		queued = len(light.waiting) + len(heavy.waiting)
+		sched.mtx.Unlock()
+	}
+	light.release()
+	wg.Wait()
+	heavies := 0
+	for _, name := range order[:12] {
+		if name == "heavy" {
+			heavies++
+		}
+	}
+	if heavies < 8 || heavies > 10 {
+		t.Fatal("heavy weight must get three workers for every one of light weight", order)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	in := NewPipe("in", int(0), 10)
+	mid := NewPipe("mid", int(0), 10)
+	out := NewPipe("out", int(0), 10)
+	running, peak, firstRunning, firstPeak := atomic.Int64{}, atomic.Int64{}, atomic.Int64{}, atomic.Int64{}
+	track := func(counter, max *atomic.Int64) func() {
+		n := counter.Add(1)
+		for old := max.Load(); n > old && !max.CompareAndSwap(old, n); old = max.Load() {
+		}
+		return func() { counter.Add(-1) }
+	}
+	first := NewFilterWithPipes("first", func(n int) int {
+		defer track(&running, &peak)()
+		defer track(&firstRunning, &firstPeak)()
+		time.Sleep(time.Millisecond * 2)
+		return n + 1
+	}, WithPipes(in), WithPipes(mid), WithLens())
+	second := NewFilterWithPipes("second", func(n int) int {
+		defer track(&running, &peak)()
+		time.Sleep(time.Millisecond * 2)
+		return n * 2
+	}, WithPipes(mid), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(first, second), WithPipes(in), WithPipes(out))
+	model.SetParallel(4)
+	model.SetBudget(Budget{
+		Workers: 3,
+		Filters: map[string]Share{"first": {Max: 1}},
+		Default: Share{Weight: 2},
+	})
+	model.Run()
+	defer model.Stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if output := model.Call(WithInput(i)); output[0] != (i+1)*2 {
+				t.Error(i, output)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if peak.Load() > 3 || firstPeak.Load() != 1 {
+		t.Fatal(peak.Load(), firstPeak.Load())
+	}
+}
+
+func TestBudgetLoop(t *testing.T) {
+	running, peak := atomic.Int64{}, atomic.Int64{}
+	track := func() func() {
+		n := running.Add(1)
+		for old := peak.Load(); n > old && !peak.CompareAndSwap(old, n); old = peak.Load() {
+		}
+		return func() { running.Add(-1) }
+	}
+	state := NewPipe("state", int(0), 1)
+	next := NewPipe("next", int(0), 1)
+	step := NewFilterWithPipes("step", func(n int) int {
+		defer track()()
+		time.Sleep(time.Millisecond)
+		return n + 1
+	}, WithPipes(state), WithPipes(next), WithLens())
+	body := NewModel(WithFilters(step), WithPipes(state), WithPipes(next))
+	in := NewPipe("in", int(0), 10)
+	mid := NewPipe("mid", int(0), 10)
+	out := NewPipe("out", int(0), 10)
+	first := NewFilterWithPipes("first", func(n int) int {
+		defer track()()
+		time.Sleep(time.Millisecond)
+		return n
+	}, WithPipes(in), WithPipes(mid), WithLens())
+	iterate := NewLoop[int]("iterate", mid, out, body, nil, 3)
+	model := NewModel(WithFilters(first, iterate), WithPipes(in), WithPipes(out))
+	model.SetParallel(4)
+	//A loop holding the only worker would never let its body run
+	model.SetBudget(Budget{Workers: 1, Filters: map[string]Share{"iterate/step": {Weight: 2}}})
+	if baseOf(step).share == nil || baseOf(step).share.stride != strideUnit/2 {
+		t.Fatal("loop body must share the budget of the model by its path")
+	}
+	model.Run()
+	defer model.Stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if output := model.Call(WithInput(i)); output[0] != i+3 {
+				t.Error(i, output)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if peak.Load() != 1 {
+		t.Fatal("calls of the model and of the loop body exceeded the budget: ", peak.Load())
+	}
+}
+
+func TestBudgetStream(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	elems := NewPipe("elems", int(0), 1)
+	squared := NewPipe("squared", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	split := NewFilterWithPipes("split", func(n int) []int {
+		elems := make([]int, n)
+		for i := range elems {
+			elems[i] = i + 1
+		}
+		return elems
+	}, WithPipes(in), WithPipes(elems), WithLens())
+	square := NewFilterWithPipes("square", func(n int) int {
+		return n * n
+	}, WithPipes(elems), WithPipes(squared), WithLens())
+	sum := NewFilterWithPipes("sum", func(squared <-chan int) int {
+		total := 0
+		for n := range squared {
+			total += n
+		}
+		return total
+	}, WithPipes(squared), WithPipes(out), WithLens(NewLen(squared, elems)))
+	model := NewModel(WithFilters(split, square, sum), WithPipes(in), WithPipes(out))
+	//A streaming filter holding the only worker would never let square send its elements
+	model.SetBudget(Budget{Workers: 1})
+	if baseOf(sum).share != nil {
+		t.Fatal("filters with channel parameters must not take a worker")
+	}
+	model.Run()
+	defer model.Stop()
+	done := make(chan []any)
+	go func() {
+		done <- model.Call(WithInput(5))
+	}()
+	select {
+	case output := <-done:
+		if output[0] != 55 {
+			t.Fatal(output)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("streaming filter waits for a worker held by itself")
+	}
+}
@@ -0,0 +1,151 @@
+package arch
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Input of a filter with a rate that doesn't match the other inputs of the filter, the pipe sends items for more
+// invocations than the filter runs in a call, for example in a diamond where one branch sends an item for every
+// element of a slice and the other one item for every call. The remaining items are taken by the next calls, so
+// the filter mixes items of different calls and its buffer fills until the producer blocks. No buffer size fixes
+// it: a bigger buffer only delays the stall while the filter returns wrong results.
+type BufferIssue struct {
+	Pipe   string //Input pipe with the higher rate
+	Filter string //Filter with uneven inputs
+	Runs   int    //Invocations of the filter in a call
+	Sent   int    //Invocations the pipe sends items for in a call
+	Reason string
+}
+
+func (issue BufferIssue) String() string {
+	return fmt.Sprintf("rate mismatch of pipe '%s' in filter '%s': %s", issue.Pipe, issue.Filter, issue.Reason)
+}
+
+// Items that a pipe carries in a call
+type rate struct {
+	items int //Items or elements
+	units int //Invocations of the producer, for pipes that send elements one by one it's the count of outer lengths
+}
+
+// Walk the filters of the model from its inputs and compute the items every pipe carries in a call, fanOut is the
+// expected number of elements of every slice or channel result sent one by one, indexed by pipe name (missing
+// pipes send one element). Filters without a fixed rate, like windows and keyed joins, end the walk.
+func (md *model) rates(fanOut map[string]int) map[Pipe]rate {
+	rates := make(map[Pipe]rate)
+	for _, pipe := range md.inputs {
+		rates[pipe] = rate{items: 1, units: 1}
+	}
+	done := make(map[*filter]bool, len(md.filters))
+	for changed := true; changed; {
+		changed = false
+		for _, f := range md.filters {
+			ftr := baseOf(f)
+			if done[ftr] {
+				continue
+			}
+			switch f.(type) {
+			case *window, *keyedJoin:
+				done[ftr] = true
+				continue
+			}
+			invs, ok := ftr.invocations(rates)
+			if !ok {
+				continue
+			}
+			inv := slowest(invs)
+			for pipe, link := range ftr.outLink {
+				r := rate{items: inv, units: inv}
+				if depth := depthOf(ftr.outs[link], pipe.CheckType()); depth > 0 {
+					fan, ok := fanOut[pipe.Name()]
+					if !ok {
+						fan = 1
+					}
+					for i := 0; i < depth; i++ {
+						r.items *= fan
+					}
+				}
+				//Merge pipes carry the items of their busiest producer
+				if prev, ok := rates[pipe]; !ok || prev.items < r.items {
+					rates[pipe] = r
+				}
+			}
+			done[ftr] = true
+			changed = true
+		}
+	}
+	return rates
+}
+
+// Invocations of filter in a call by every input pipe, items are taken one by one and slices or channels take
+// one invocation for every length. It's false if the rate of an input is unknown.
+func (ftr *filter) invocations(rates map[Pipe]rate) (map[Pipe]int, bool) {
+	invs := make(map[Pipe]int, len(ftr.inLink))
+	for pipe := range ftr.inLink {
+		if length := ftr.length[pipe]; length != nil {
+			r, ok := rates[length]
+			if !ok {
+				return nil, false
+			}
+			invs[pipe] = r.units
+		} else {
+			r, ok := rates[pipe]
+			if !ok {
+				return nil, false
+			}
+			invs[pipe] = r.items
+		}
+	}
+	return invs, true
+}
+
+// Invocations of a filter in a call, it runs as many times as its slowest input. Source filters run once.
+func slowest(invs map[Pipe]int) int {
+	inv, first := 1, true
+	for _, n := range invs {
+		if first || n < inv {
+			inv, first = n, false
+		}
+	}
+	return inv
+}
+
+// Find filters with uneven inputs, fanOut is the expected number of elements of every slice or channel result sent
+// one by one, indexed by pipe name. Lengths are only known at runtime, so fan-outs can't be derived from the model
+// and they must be given by the caller: pipes missing from fanOut are counted as one element and their issues aren't
+// found. Issues are sorted by pipe name.
+func (md *model) CheckBuffers(fanOut map[string]int) []BufferIssue {
+	rates := md.rates(fanOut)
+	issues := make([]BufferIssue, 0, 10)
+	for _, f := range md.filters {
+		ftr := baseOf(f)
+		invs, ok := ftr.invocations(rates)
+		if !ok || len(invs) < 2 {
+			continue
+		}
+		inv := slowest(invs)
+		pipes := make([]Pipe, 0, len(invs))
+		for pipe := range invs {
+			pipes = append(pipes, pipe)
+		}
+		sort.Slice(pipes, func(i, j int) bool { return pipes[i].Name() < pipes[j].Name() })
+		for _, pipe := range pipes {
+			if invs[pipe] <= inv {
+				continue
+			}
+			reason := fmt.Sprintf("filter '%s' runs %d times in a call but pipe '%s' sends items for %d, the remaining items are taken by the next calls", ftr.name, inv, pipe.Name(), invs[pipe])
+			if length := ftr.length[pipe]; length != nil && length != pipe {
+				reason = fmt.Sprintf("filter '%s' runs %d times in a call but pipe '%s' sends lengths of pipe '%s' for %d, the remaining lengths are taken by the next calls", ftr.name, inv, length.Name(), pipe.Name(), invs[pipe])
+			}
+			issues = append(issues, BufferIssue{
+				Pipe:   pipe.Name(),
+				Filter: ftr.name,
+				Runs:   inv,
+				Sent:   invs[pipe],
+				Reason: reason,
+			})
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Pipe < issues[j].Pipe })
+	return issues
+}
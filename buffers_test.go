@@ -0,0 +1,131 @@
+package arch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCheckBuffers(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	elems := NewPipe("elems", int(0), 1)
+	squared := NewPipe("squared", int(0), 1)
+	total := NewPipe("total", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	split := NewFilterWithPipes("split", func(n int) []int {
+		return make([]int, n)
+	}, WithPipes(in), WithPipes(elems), WithLens())
+	square := NewFilterWithPipes("square", func(n int) int {
+		return n * n
+	}, WithPipes(elems), WithPipes(squared), WithLens())
+	count := NewFilterWithPipes("count", func(elems []int) int {
+		return len(elems)
+	}, WithPipes(elems), WithPipes(total), WithLens(NewLen(elems, elems)))
+	//Diamond with uneven inputs, squared sends an item for every element and total one for every call
+	combine := NewFilterWithPipes("combine", func(squared, total int) int {
+		return squared + total
+	}, WithPipes(squared, total), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(split, square, count, combine), WithPipes(in), WithPipes(out))
+	issues := model.CheckBuffers(map[string]int{"elems": 4})
+	if len(issues) != 1 {
+		t.Fatal(issues)
+	}
+	if issue := issues[0]; issue.Pipe != "squared" || issue.Filter != "combine" || issue.Runs != 1 || issue.Sent != 4 {
+		t.Fatal(issue)
+	}
+	if issues := model.CheckBuffers(map[string]int{"elems": 1}); len(issues) != 0 {
+		t.Fatal(issues)
+	}
+	//The rate mismatch is reported without resizing the pipes
+	if buffer := itemsOf(squared).stats().Buffer; buffer != 1 {
+		t.Fatal(buffer)
+	}
+	model.Run()
+	defer model.Stop()
+	if output := model.Call(WithInput(1)); output[0] != 1 {
+		t.Fatal(output)
+	}
+}
+
+func TestCheckBuffersEven(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	elems := NewPipe("elems", int(0), 1)
+	squared := NewPipe("squared", int(0), 1)
+	total := NewPipe("total", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	split := NewFilterWithPipes("split", func(n int) []int {
+		return make([]int, n)
+	}, WithPipes(in), WithPipes(elems), WithLens())
+	square := NewFilterWithPipes("square", func(n int) int {
+		return n * n
+	}, WithPipes(elems), WithPipes(squared), WithLens())
+	count := NewFilterWithPipes("count", func(elems []int) int {
+		return len(elems)
+	}, WithPipes(elems), WithPipes(total), WithLens(NewLen(elems, elems)))
+	//Squared elements are gathered with the length of elems, so both inputs are taken once in a call
+	combine := NewFilterWithPipes("combine", func(squared []int, total int) int {
+		return len(squared) + total
+	}, WithPipes(squared, total), WithPipes(out), WithLens(NewLen(squared, elems)))
+	model := NewModel(WithFilters(split, square, count, combine), WithPipes(in), WithPipes(out))
+	if issues := model.CheckBuffers(map[string]int{"elems": 100}); len(issues) != 0 {
+		t.Fatal(issues)
+	}
+}
+
+// Diamond of example/custom, duplicated feeds triplicate and square and both branches are joined again
+func customDiamond(triplicate any) (Model, Pipe) {
+	input := NewPipe("input", int(0), 1)
+	duplicated := NewPipe("duplicated", int(0), 1)
+	triplicated := NewPipe("triplicated", int(0), 1)
+	squared := NewPipe("squared", float64(0), 1)
+	cubed := NewPipe("cubed", float64(0), 1)
+	loged := NewPipe("loged", float64(0), 1)
+	tripXsquared := NewPipe("3xsqrt", float64(0), 1)
+	output := NewPipe("output", float64(0), 1)
+	duplicate := NewFilterWithPipes("duplicate", func(input int) int {
+		return 2 * input
+	}, WithPipes(input), WithPipes(duplicated), WithLens())
+	triplicateFilter := NewFilterWithPipes("triplicate", triplicate, WithPipes(duplicated), WithPipes(triplicated), WithLens())
+	square := NewFilterWithPipes("square", func(input int) float64 {
+		return math.Sqrt(float64(input))
+	}, WithPipes(duplicated), WithPipes(squared), WithLens())
+	tripXsquare := NewFilterWithPipes("3xsquare", func(triplicated int, squared float64) float64 {
+		return float64(triplicated) * squared
+	}, WithPipes(triplicated, squared), WithPipes(tripXsquared), WithLens())
+	logxcub := NewFilterWithPipes("multiple", func(triplicated int, squared float64) (float64, float64) {
+		return math.Pow(float64(triplicated)*squared, 3), math.Log(float64(triplicated) * squared)
+	}, WithPipes(triplicated, squared), WithPipes(cubed, loged), WithLens())
+	substract := NewFilterWithPipes("substract", func(cubed, loged, tripxsquare float64) float64 {
+		return cubed - loged - tripxsquare
+	}, WithPipes(cubed, loged, tripXsquared), WithPipes(output), WithLens())
+	filters := WithFilters(duplicate, triplicateFilter, square, tripXsquare, logxcub, substract)
+	return NewModel(filters, WithPipes(input), WithPipes(output)), triplicated
+}
+
+func TestCheckBuffersCustomDiamond(t *testing.T) {
+	//Every filter of the diamond sends one item in a call, so its branches are even
+	model, _ := customDiamond(func(input int) int {
+		return 3 * input
+	})
+	if issues := model.CheckBuffers(nil); len(issues) != 0 {
+		t.Fatal(issues)
+	}
+	//Triplicate sends three elements one by one, the analyzer knows it only from the fan-out given by the caller
+	model, triplicated := customDiamond(func(input int) []int {
+		return []int{input, input, input}
+	})
+	if issues := model.CheckBuffers(nil); len(issues) != 0 {
+		t.Fatal("pipes without fan-out send one element: ", issues)
+	}
+	issues := model.CheckBuffers(map[string]int{"triplicated": 3})
+	if len(issues) != 2 {
+		t.Fatal(issues)
+	}
+	for i, filter := range []string{"3xsquare", "multiple"} {
+		if issue := issues[i]; issue.Pipe != "triplicated" || issue.Filter != filter || issue.Runs != 1 || issue.Sent != 3 {
+			t.Fatal(issue)
+		}
+	}
+	if buffer := itemsOf(triplicated).stats().Buffer; buffer != 1 {
+		t.Fatal(buffer)
+	}
+}
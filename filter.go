@@ -1,12 +1,15 @@
 package arch
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	//"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // It's produced when filter has an error in its definition
@@ -27,28 +30,64 @@ type Filter interface {
 	Compile() error                 //Compile filter and test if it has errors in its definition
 	SetSignal(signal Signal)        //Set signal to control filter gorutines
 	SetParallel(parallel int) error //Control number of filter gorutines for processing multiple inputs at the same time
+	SetHooks(hooks Hooks)           //Set callbacks for logging and instrumentation, they can be replaced while running
 	Run()                           //Run filter, it's must be run in a gorutine
+	IsSource() bool                 //Tell if filter has no input pipes
+	IsSink() bool                   //Tell if filter has no output pipes
+	KeyedState() map[string]any     //Copy of filter state for every key
 	Clear()                         //Clear errors
 	Errs() []error                  //Return internal error list
 	HasErrs() bool                  //Tell if there are errors
 	PrintErrs()                     //Print errors
 }
 
+// Filter that is implemented by this package, composite filters like loops embed the filter implementation
+type baseFilter interface {
+	Filter
+	base() *filter
+}
+
+// Implementation of filter, filters linked to models must be created by this package
+func baseOf(f Filter) *filter {
+	bf, ok := f.(baseFilter)
+	if !ok {
+		panic(fmt.Errorf("filter '%s' must be created with NewFilter or another filter constructor of this package", f.Name()))
+	}
+	return bf.base()
+}
+
 type filter struct {
-	name     string
-	inLink   map[Pipe]int //Redirect data between pipe and method
-	outLink  map[Pipe]int //Redirect data between method output and pipe
-	length   map[Pipe]Pipe
-	input    *collection
-	output   *collection
-	fn       *function
-	outs     []reflect.Type
-	errs     []error
-	parallel int
-	sg       *signal
-	lck      chan int
-	q        *queue
-	compiled bool
+	name        string
+	inLink      map[Pipe]int //Redirect data between pipe and method
+	outLink     map[Pipe]int //Redirect data between method output and pipe
+	length      map[Pipe]Pipe
+	injected    map[int]reflect.Type //Function parameters injected by filter (Metadata, context.Context or State)
+	state       *stateStore
+	input       *collection
+	output      *collection
+	fn          *function
+	ins         []reflect.Type //Types of function parameters followed by types of fields of struct parameters
+	outs        []reflect.Type //Types of function results followed by types of fields of struct results
+	inFields    []fieldLink
+	outFields   []fieldLink
+	more        int //Index of the result that tells if a source filter has more items, -1 if there is not
+	errs        []error
+	parallel    int
+	sg          *signal
+	lck         chan int
+	q           *queue
+	compiled    bool
+	batches     map[Pipe]batch //Last slice received from every pipe with length
+	mtxBatch    sync.Mutex
+	elemTimeout time.Duration //Time waiting for every element of a slice, zero waits until it arrives
+	counters    filterStats
+	tracer      *Tracer
+	hooks       atomic.Pointer[Hooks]
+	waits       *waits        //Operations of pipes that block filter, nil without watchdog
+	workers     *limiter      //Calls running at the same time, nil without autoscaler
+	share       *share        //Workers of the model budget, nil without budget
+	prioritized *atomic.Bool  //Set when the model is called with priorities, nil outside a model
+	byCall      map[Pipe]bool //Inputs whose items carry the seq of their call, only they follow the leader input
 }
 
 func NewFilter(name string) Filter {
@@ -59,9 +98,13 @@ func NewFilter(name string) Filter {
 		inLink:   make(map[Pipe]int),
 		outLink:  make(map[Pipe]int),
 		length:   make(map[Pipe]Pipe),
+		injected: make(map[int]reflect.Type),
+		state:    newStateStore(),
+		batches:  make(map[Pipe]batch),
 		errs:     make([]error, 0, 10),
 		lck:      make(chan int, 1),
 		parallel: 1,
+		more:     -1,
 	}
 }
 
@@ -94,10 +137,46 @@ func (ftr *filter) Compile() error {
 	if err := fn.Compile(); err != nil {
 		return err
 	}
+	ftype := fn.fnType
+	//Links are made again, so a filter can be compiled several times
+	ftr.inLink = make(map[Pipe]int)
+	ftr.outLink = make(map[Pipe]int)
+	ftr.length = make(map[Pipe]Pipe)
+	ftr.injected = make(map[int]reflect.Type)
+	ftr.ins = make([]reflect.Type, ftype.NumIn())
+	for i := 0; i < ftype.NumIn(); i++ {
+		ftr.ins[i] = ftype.In(i)
+	}
+	ftr.inFields = nil
 	for i := 0; i < len(fn.ins); i++ {
 		inType := fn.fnType.In(i)
-		if fn.ins[i] == "" {
+		if isInjected(inType) {
+			ftr.injected[i] = inType
+			continue
+		}
+		if fn.ins[i] == "" && isDestructured(inType) {
+			//Fields of struct parameters are filled from the pipes named in their tags
+			var err error
+			fields := len(ftr.inFields)
+			ftr.ins, ftr.inFields, err = linkFields(ftr.name, i, inType, ftr.input, ftr.inLink, ftr.ins, ftr.inFields)
+			if err != nil {
+				return err
+			}
+			for _, link := range ftr.inFields[fields:] {
+				pipe, _ := ftr.input.GetNamed(inType.Field(link.field).Tag.Get("pipe"))
+				if depthOf(ftr.ins[link.slot], pipe.CheckType()) > 0 {
+					length, err := ftr.input.GetLenFor(pipe)
+					if err != nil {
+						return err
+					}
+					ftr.length[pipe] = length
+				}
+			}
+		} else if fn.ins[i] == "" {
 			pipe, err := ftr.input.Get(inType)
+			if elem, ok := optionalElem(inType); err != nil && ok {
+				pipe, err = ftr.input.Get(elem)
+			}
 			if err != nil {
 				return err
 			}
@@ -111,10 +190,10 @@ func (ftr *filter) Compile() error {
 				return err
 			}
 
-			if pipe.CheckType() != inType && (inType.Kind() != reflect.Slice || pipe.CheckType() != inType.Elem()) {
+			if !linkable(pipe.CheckType(), inType) {
 				return fmt.Errorf("filter '%s' has input pipe '%s' of type '%s' linked to type '%s'", ftr.name, pipe.Name(), pipe.CheckType(), inType)
 			}
-			if inType.Kind() == reflect.Slice && pipe.CheckType() == inType.Elem() {
+			if depthOf(inType, pipe.CheckType()) > 0 {
 				length, err := ftr.input.GetLenFor(pipe)
 				if err != nil {
 					return err
@@ -124,10 +203,36 @@ func (ftr *filter) Compile() error {
 			ftr.inLink[pipe] = i
 		}
 	}
-	for i := 0; i < len(fn.outs); i++ {
+	//A source filter can tell when it's exhausted with a last result of bool type not linked to a pipe, the names
+	//of the function are not changed so the filter can be compiled again
+	outs := fn.outs
+	ftr.more = -1
+	if len(ftr.inLink) == 0 && len(outs) > 0 {
+		last := len(outs) - 1
+		if outs[last] == "" && fn.fnType.Out(last).Kind() == reflect.Bool && !ftr.output.Has(fn.fnType.Out(last)) {
+			ftr.more = last
+			outs = outs[:last]
+		}
+	}
+	ftr.outs = make([]reflect.Type, ftype.NumOut())
+	for i := 0; i < ftype.NumOut(); i++ {
+		ftr.outs[i] = ftype.Out(i)
+	}
+	ftr.outFields = nil
+	for i := 0; i < len(outs); i++ {
 		outType := fn.fnType.Out(i)
-		if fn.outs[i] == "" {
+		if outs[i] == "" && isDestructured(outType) {
+			//Fields of struct results are sent through the pipes named in their tags
+			var err error
+			ftr.outs, ftr.outFields, err = linkFields(ftr.name, i, outType, ftr.output, ftr.outLink, ftr.outs, ftr.outFields)
+			if err != nil {
+				return err
+			}
+		} else if outs[i] == "" {
 			pipe, err := ftr.output.Get(outType)
+			if elem, ok := optionalElem(outType); err != nil && ok {
+				pipe, err = ftr.output.Get(elem)
+			}
 			if err != nil {
 				return err
 			}
@@ -136,25 +241,44 @@ func (ftr *filter) Compile() error {
 			}
 			ftr.outLink[pipe] = i
 		} else {
-			pipe, err := ftr.output.GetNamed(fn.outs[i])
+			pipe, err := ftr.output.GetNamed(outs[i])
 			if err != nil {
 				return err
 			}
-			if outType != pipe.CheckType() && (outType.Kind() != reflect.Slice || pipe.CheckType() != outType.Elem()) {
+			if !linkable(pipe.CheckType(), outType) {
 				return fmt.Errorf("filter '%s' has output pipe '%s' of type '%s' linked to type '%s'", ftr.name, pipe.Name(), pipe.CheckType(), outType)
 			}
 			ftr.outLink[pipe] = i
 		}
 	}
-	ftype := fn.fnType
-	ftr.outs = make([]reflect.Type, ftype.NumOut())
-	for i := 0; i < ftype.NumOut(); i++ {
-		ftr.outs[i] = ftype.Out(i)
+	//Merge pipes need to know every filter that sends items
+	for pipe := range ftr.outLink {
+		if mp, ok := pipe.(*mergePipe); ok {
+			mp.from(ftr)
+		}
 	}
 	ftr.compiled = true
 	return nil
 }
 
+// Tell if a pipe can be linked to a function parameter or result, the pipe type could be the same type,
+// the type of slice or channel elements (slices could be nested) or the type of an Optional[T] value
+func linkable(pipeType, paramType reflect.Type) bool {
+	if pipeType == paramType {
+		return true
+	}
+	if depthOf(paramType, pipeType) > 0 {
+		return true
+	}
+	elem, ok := optionalElem(paramType)
+	return ok && pipeType == elem
+}
+
+// Tell if a filter output sends the elements of a slice or a channel one by one through pipe
+func sendsOneByOne(outType reflect.Type, pipe Pipe) bool {
+	return depthOf(outType, pipe.CheckType()) > 0
+}
+
 func (ftr *filter) call(input []reflect.Value) (output []reflect.Value, err error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -162,11 +286,14 @@ func (ftr *filter) call(input []reflect.Value) (output []reflect.Value, err erro
 		}
 	}()
 	output = ftr.fn.method.Call(input)
+	if len(output) == 0 {
+		return output, nil
+	}
 	last := output[len(output)-1].Interface()
 	if err, ok := last.(error); ok {
 		return nil, err
 	}
-	return output, nil
+	return ftr.expand(output), nil
 }
 
 func (ftr *filter) Clear() {
@@ -181,19 +308,40 @@ func (ftr *filter) Run() {
 	if !ftr.compiled {
 		panic(ErrFilterNotCompiled)
 	}
-	ftr.q = newQueue(ftr.parallel)
+	ftr.started()
+	defer ftr.stopped()
+	if ftr.workers != nil {
+		ftr.q = newLimitedQueue(ftr.parallel, ftr.workers)
+	} else {
+		ftr.q = newQueue(ftr.parallel)
+	}
 	ftr.q.run(func(v any) {
 		msg := v.(*msg)
-		ftr.send(msg.output, msg.err, msg.unset)
+		if msg.end {
+			ftr.sendEnd(msg.head)
+		} else {
+			msg.span.send()
+			ftr.send(msg.output, msg.head, msg.err, msg.unset)
+			msg.span.finish()
+		}
 	})
 	ftr.errs = make([]error, 0, 10)
 	sg := ftr.sg
-	for ftr.input.IsOpen() && ftr.output.IsOpen() {
+	seq := uint64(0)
+	leader := ftr.leader()
+	//Filter stops when an input pipe is closed, items sent before closing that are waiting in the pipe are received
+	for (ftr.input.IsOpen() || ftr.waiting()) && ftr.output.IsOpen() {
 		if sg.tryStop() {
 			break
 		}
-		input := make([]reflect.Value, len(ftr.fn.ins))
-		unset := false
+		sp := ftr.tracer.begin(ftr.name)
+		input := make([]reflect.Value, len(ftr.ins))
+		heads := make([]header, len(ftr.ins))
+		streams := make([]*stream, len(ftr.ins))
+		unset, end := false, false
+		closed := atomic.Bool{} //every input that is closed or stopped sets it
+		//With priorities the leader input receives the call of the invocation and the other inputs follow it
+		ld := ftr.follow()
 		wg := sync.WaitGroup{}
 		ftr.input.ForEach(func(pipe Pipe) bool {
 			wg.Add(1)
@@ -203,20 +351,86 @@ func (ftr *filter) Run() {
 				length := ftr.length[pipe]
 				if length != nil {
 					//fmt.Println(ftr.name, " <- Len ", pipe.Name())
-					sliceLen := length.Len(pipe)
-					slice := reflect.MakeSlice(reflect.SliceOf(pipe.CheckType()), sliceLen, sliceLen)
-					for i := 0; i < sliceLen; i++ {
-						//fmt.Println(ftr.name, " [", i, "] <- ", pipe.Name())
-						if v := pipe.Get(ftr); v != nil {
-							slice.Index(i).Set(reflect.ValueOf(v))
+					done := ftr.waitFor(OpLen, length)
+					count, seq, ok := itemsOf(length).recvLen(pipe)
+					done()
+					if pipe == leader {
+						ld.set(seq, !ok)
+					}
+					sliceLen := lenItem{count: count, seq: seq}
+					if !ok {
+						closed.Store(true)
+						return
+					}
+					inType := ftr.ins[index]
+					if isStream(inType) {
+						//Channel parameters receive the elements while the function runs
+						st := newStream(pipe, ftr, inType, sliceLen)
+						streams[index] = st
+						if input[index], ok = st.param(inType); !ok {
+							closed.Store(true)
+							return
 						}
+						heads[index] = scoped(pipe, st.head)
+						return
+					}
+					slice, head, ok, err := recvSlice(pipe, length, ftr, inType, sliceLen)
+					if !ok {
+						closed.Store(true)
+						return
+					}
+					if err != nil {
+						//The call is skipped when its elements don't match their length
+						ftr.fail(err)
+						heads[index] = scoped(pipe, head)
+						unset = true
+						return
 					}
 					input[index] = slice
+					heads[index] = scoped(pipe, head)
 				} else {
 					//fmt.Println(ftr.name, " <- ", pipe.Name())
-					value := pipe.Get(ftr)
-					if value != nil {
-						input[index] = reflect.ValueOf(value)
+					var it *item
+					done := ftr.waitFor(OpGet, pipe)
+					switch {
+					case ld == nil:
+						//Filters of a stopped model don't wait for items that would never arrive
+						it, _ = itemsOf(pipe).recvWithin(ftr, sg.stop, 0)
+					case pipe == leader:
+						it = itemsOf(pipe).recvPriority(ftr)
+						if it != nil {
+							ld.set(it.seq, false)
+						} else {
+							ld.set(0, true)
+						}
+					default:
+						<-ld.ready
+						if !ld.closed {
+							//Inputs whose items don't carry the seq of their call are received in arrival order
+							seq := ld.seq
+							if !ftr.byCall[pipe] || !ftr.byCall[leader] {
+								seq = 0
+							}
+							it = itemsOf(pipe).recvCall(ftr, seq)
+						}
+					}
+					done()
+					if it == nil {
+						closed.Store(true)
+						return
+					}
+					ftr.arrived(pipe, it)
+					heads[index] = scoped(pipe, it.header)
+					if it.end {
+						end = true
+						return
+					}
+					inType := ftr.ins[index]
+					if _, ok := optionalElem(inType); ok && pipe.CheckType() != inType {
+						//Optional parameters don't skip the function when the item is unset
+						input[index] = makeOptional(inType, it.data)
+					} else if it.data != nil {
+						input[index] = reflect.ValueOf(it.data)
 					} else {
 						unset = true
 					}
@@ -225,50 +439,139 @@ func (ftr *filter) Run() {
 			return true
 		})
 		wg.Wait()
-		if sg.tryStop() {
+		if closed.Load() || sg.tryStop() {
+			sp.discard()
+			drainStreams(streams)
 			break
 		}
-		if ftr.parallel > 1 {
+		//Headers of every input are merged in the order of function parameters
+		head := mergeHeaders(heads)
+		if ftr.IsSource() {
+			//Every item produced by a source is a new call
+			seq++
+			head.seq = seq
+		}
+		sp.receive(head.seq)
+		if end {
+			sp.discard()
+			//Filters that receive streamed elements one by one forward the end to their outputs
+			if ftr.parallel > 1 {
+				ftr.q.push(input) <- &msg{head: head, end: true}
+				ftr.q.set()
+			} else {
+				ftr.sendEnd(head)
+			}
+			continue
+		}
+		if !unset {
+			input = ftr.assemble(input)
+		}
+		ftr.inject(input, head)
+		if ftr.parallel > 1 && !ftr.IsSource() {
 			ch := ftr.q.push(input)
-			go ftr.process(input, ch, unset)
+			done := make(chan int)
+			go func() {
+				defer close(done)
+				ftr.process(input, head, ch, unset, sp)
+			}()
+			if hasStreams(streams) {
+				//Next items can't be received until the function stops receiving elements
+				<-done
+				drainStreams(streams)
+			}
 		} else {
-			ftr.send(ftr.process(input, nil, unset))
+			output, head, err, unset := ftr.process(input, head, nil, unset, sp)
+			drainStreams(streams)
+			if ftr.more >= 0 && err == nil && !output[ftr.more].Bool() {
+				sp.discard()
+				break //source is exhausted
+			}
+			sp.send()
+			ftr.send(output, head, err, unset)
+			sp.finish()
 		}
 	}
 	ftr.output.Close()
-	ftr.input.Close()
+	ftr.closeInputs()
 	ftr.q.exit()
 }
 
+// Close input pipes when filter finishes, other filters of a stopped model could still be sending through them
+func (ftr *filter) closeInputs() {
+	if ftr.sg == nil || !ftr.sg.tryStop() {
+		ftr.input.Close()
+	}
+}
+
+// Tell if an input pipe holds items that are waiting to be received by filter
+func (ftr *filter) waiting() bool {
+	found := false
+	ftr.input.ForEach(func(pipe Pipe) bool {
+		found = len(itemsOf(pipe).channel(ftr)) > 0
+		return !found
+	})
+	return found
+}
+
 type msg struct {
 	output []reflect.Value
+	head   header
 	err    error
 	unset  bool
+	end    bool
+	span   *span
+}
+
+// Context of the model of filter, it's cancelled when the model is stopped
+func (ftr *filter) context() context.Context {
+	if ftr.sg == nil {
+		return context.Background()
+	}
+	return ftr.sg.ctx
+}
+
+// Set values of parameters injected by filter
+func (ftr *filter) inject(input []reflect.Value, head header) {
+	for index, inType := range ftr.injected {
+		switch inType {
+		case metadataType:
+			input[index] = reflect.ValueOf(head.meta)
+		case contextType:
+			input[index] = reflect.ValueOf(ContextWithMetadata(ftr.context(), head.meta))
+		case stateType:
+			input[index] = reflect.ValueOf(&keyedState{key: head.key, store: ftr.state})
+		}
+	}
 }
 
-func (ftr *filter) process(input []reflect.Value, send chan any, unset bool) ([]reflect.Value, error, bool) {
+func (ftr *filter) process(input []reflect.Value, head header, send chan any, unset bool, sp *span) ([]reflect.Value, header, error, bool) {
 	var output []reflect.Value
 	var err error
 	if !unset {
+		ftr.share.acquire()
+		start := ftr.counters.begin()
 		output, err = ftr.call(input)
+		ftr.counters.end(start)
+		ftr.share.release()
 		if err != nil {
-			ftr.lck <- 0
-			ftr.errs = append(ftr.errs, err)
-			<-ftr.lck
+			ftr.fail(err)
 		}
 	}
+	sp.execute(err, unset)
 	if send != nil {
 		send <- &msg{
 			output: output,
+			head:   head,
 			err:    err,
 			unset:  unset,
+			span:   sp,
 		}
 		ftr.q.set()
 	}
-	return output, err, unset
+	return output, head, err, unset
 }
 
-func (ftr *filter) send(output []reflect.Value, err error, unset bool) {
+func (ftr *filter) send(output []reflect.Value, head header, err error, unset bool) {
 	wg := sync.WaitGroup{}
 	ftr.output.ForEach(func(pipe Pipe) bool {
 		wg.Add(1)
@@ -276,21 +579,32 @@ func (ftr *filter) send(output []reflect.Value, err error, unset bool) {
 			defer wg.Done()
 			index := ftr.outLink[pipe]
 			otype := ftr.outs[index]
-			if otype.Kind() == reflect.Slice && pipe.CheckType() == otype.Elem() {
+			if isStream(otype) && pipe.CheckType() == otype.Elem() {
 				if err != nil || unset {
-					pipe.SetLen(0)
+					ftr.sendLen(pipe, 0, head.seq)
 				} else {
-					out := output[index]
-					pipe.SetLen(out.Len())
-					for i := 0; i < out.Len(); i++ {
-						pipe.Set(out.Index(i).Interface())
-					}
+					ftr.sendStream(pipe, output[index], head)
+				}
+			} else if depth := depthOf(otype, pipe.CheckType()); depth > 0 {
+				if err != nil || unset {
+					ftr.sendLen(pipe, 0, head.seq)
+				} else {
+					ftr.sendSlice(pipe, output[index], depth, head)
+				}
+			} else if _, ok := optionalElem(otype); ok && pipe.CheckType() != otype {
+				//An absent optional value skips the pipe
+				if err != nil || unset {
+					ftr.sendItem(pipe, &item{header: head})
+				} else if data, valid := output[index].Interface().(optionalValue).optional(); valid {
+					ftr.sendItem(pipe, &item{data: data, header: head})
+				} else {
+					ftr.sendItem(pipe, &item{header: head})
 				}
 			} else {
 				if err != nil || unset {
-					pipe.Set(nil)
+					ftr.sendItem(pipe, &item{header: head})
 				} else {
-					pipe.Set(output[index].Interface())
+					ftr.sendItem(pipe, &item{data: output[index].Interface(), header: head})
 				}
 			}
 		}()
@@ -299,9 +613,37 @@ func (ftr *filter) send(output []reflect.Value, err error, unset bool) {
 	wg.Wait()
 }
 
+// Send the end of streamed elements through outputs that send an item for every element
+func (ftr *filter) sendEnd(head header) {
+	ftr.output.ForEach(func(pipe Pipe) bool {
+		if !sendsOneByOne(ftr.outs[ftr.outLink[pipe]], pipe) {
+			ftr.sendItem(pipe, &item{end: true, header: head})
+		}
+		return true
+	})
+}
+
+func (ftr *filter) KeyedState() map[string]any {
+	return ftr.state.snapshot()
+}
+
+func (ftr *filter) base() *filter {
+	return ftr
+}
+
+// Tell if filter has no input pipes, a source filter runs its function until it's exhausted or stopped
+func (ftr *filter) IsSource() bool {
+	return ftr.compiled && len(ftr.inLink) == 0
+}
+
+// Tell if filter has no output pipes, a sink filter terminates a branch of the model
+func (ftr *filter) IsSink() bool {
+	return ftr.compiled && len(ftr.outLink) == 0
+}
+
 func (ftr *filter) SetSignal(sg Signal) {
 	ftr.sg = sg.(*signal)
-	ftr.sg.count++
+	ftr.sg.add()
 }
 
 func (ftr *filter) HasErrs() bool {
@@ -44,12 +44,27 @@ func FuncOf(fn any) Function {
 }
 
 func (fn *function) In(pipe Pipe) Function {
+	//Pipes named in tags of struct parameters are linked to their fields
+	if hasField(fn.fnType.In, fn.fnType.NumIn(), pipe.Name()) {
+		return fn
+	}
+	//Skip parameters injected by filter like Metadata or context.Context, and struct parameters with pipe tags
+	for fn.inc < len(fn.ins) && (isInjected(fn.fnType.In(fn.inc)) || isDestructured(fn.fnType.In(fn.inc))) {
+		fn.inc++
+	}
 	fn.NameIn(fn.inc, pipe.Name())
 	fn.inc++
 	return fn
 }
 
 func (fn *function) Out(pipe Pipe) Function {
+	//Pipes named in tags of struct results are linked to their fields
+	if hasField(fn.fnType.Out, fn.fnType.NumOut(), pipe.Name()) {
+		return fn
+	}
+	for fn.outc < len(fn.outs) && isDestructured(fn.fnType.Out(fn.outc)) {
+		fn.outc++
+	}
 	fn.NameOut(fn.outc, pipe.Name())
 	fn.outc++
 	return fn
@@ -81,6 +96,9 @@ func (fn *function) Compile() error {
 	outTypes := map[reflect.Type]int{}
 	for i := 0; i < fn.fnType.NumIn(); i++ {
 		curr := fn.fnType.In(i)
+		if isInjected(curr) || (fn.ins[i] == "" && isDestructured(curr)) {
+			continue
+		}
 		if fn.ins[i] == "" {
 			inTypes[curr]++
 			if inTypes[curr] > 1 {
@@ -88,17 +106,32 @@ func (fn *function) Compile() error {
 			}
 		}
 	}
-	for i := 0; i < fn.fnType.NumOut(); i++ {
+	for i := 0; i < len(fn.outs); i++ {
 		curr := fn.fnType.Out(i)
-		if fn.outs[i] == "" {
+		if fn.outs[i] == "" && !isDestructured(curr) {
 			outTypes[curr]++
 			if outTypes[curr] > 1 {
 				return fmt.Errorf("output parameter of type '%s' in position %d has no name and its type is allready in use", curr.String(), i)
 			}
 		}
 	}
-	if fn.fnType.NumOut() > 0 && fn.fnType.Out(fn.fnType.NumOut()-1) == reflect.TypeOf((*error)(nil)).Elem() {
+	//The error result is removed once, so the function can be compiled again
+	if fn.fnType.NumOut() > 0 && len(fn.outs) == fn.fnType.NumOut() && fn.fnType.Out(fn.fnType.NumOut()-1) == reflect.TypeOf((*error)(nil)).Elem() {
 		fn.outs = fn.outs[:len(fn.outs)-1]
 	}
 	return nil
 }
+
+// Tell if name is in a pipe tag of a struct parameter or result
+func hasField(types func(int) reflect.Type, count int, name string) bool {
+	for i := 0; i < count; i++ {
+		if t := types(i); isDestructured(t) {
+			for j := 0; j < t.NumField(); j++ {
+				if tag, ok := t.Field(j).Tag.Lookup("pipe"); ok && tag == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
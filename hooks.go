@@ -0,0 +1,92 @@
+package arch
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Time a filter can be blocked sending an item before OnStall is called, it's used when StallAfter is zero
+const DefaultStallAfter = time.Second
+
+// Callbacks to plug in loggers and instrumentation, nil callbacks are not invoked. They are called from the
+// goroutines of the filters, so they must be safe for concurrent use and they should return quickly.
+//
+// Items sent and received outside the filters, by the inputs and outputs of a model or with the Set and Get
+// methods of its pipes, are reported with an empty filter name.
+type Hooks struct {
+	OnFilterStart func(filter string)                              //Filter starts running
+	OnFilterStop  func(filter string)                              //Filter stops running
+	OnItemIn      func(filter, pipe string, seq uint64)            //Filter received an item or an element from pipe
+	OnItemOut     func(filter, pipe string, seq uint64)            //Filter sent an item or an element through pipe
+	OnError       func(filter string, err error)                   //Error added to the errors of filter
+	OnStall       func(filter, pipe string, blocked time.Duration) //Filter is blocked sending through pipe for StallAfter
+	StallAfter    time.Duration                                    //Time blocked before OnStall, zero uses DefaultStallAfter
+}
+
+// Set hooks of filter, they can be replaced while filter runs
+func (ftr *filter) SetHooks(hooks Hooks) {
+	ftr.hooks.Store(&hooks)
+}
+
+// Filter starts running
+func (ftr *filter) started() {
+	if hooks := ftr.hooks.Load(); hooks != nil && hooks.OnFilterStart != nil {
+		hooks.OnFilterStart(ftr.name)
+	}
+}
+
+// Filter stops running
+func (ftr *filter) stopped() {
+	if hooks := ftr.hooks.Load(); hooks != nil && hooks.OnFilterStop != nil {
+		hooks.OnFilterStop(ftr.name)
+	}
+}
+
+// Item was received from pipe, end items are not reported
+func (ftr *filter) arrived(pipe Pipe, it *item) {
+	itemIn(&ftr.hooks, ftr.name, pipe, it)
+}
+
+// Item was received from pipe by filter, end items are not reported
+func itemIn(hooked *atomic.Pointer[Hooks], filter string, pipe Pipe, it *item) {
+	if hooks := hooked.Load(); hooks != nil && hooks.OnItemIn != nil && it != nil && !it.end {
+		hooks.OnItemIn(filter, pipe.Name(), it.seq)
+	}
+}
+
+// Item was sent through pipe by filter, end items are not reported
+func itemOut(hooked *atomic.Pointer[Hooks], filter string, pipe Pipe, it *item) {
+	if hooks := hooked.Load(); hooks != nil && hooks.OnItemOut != nil && !it.end {
+		hooks.OnItemOut(filter, pipe.Name(), it.seq)
+	}
+}
+
+// Set hooks of pipe for items sent with Set and received with Get outside the filters
+func (pipe *pipe) setHooks(hooks *Hooks) {
+	pipe.hooks.Store(hooks)
+}
+
+// Send item through pipe, OnStall is called while the filter is blocked sending it
+func (ftr *filter) sendItem(pipe Pipe, it *item) {
+	defer ftr.waitFor(OpSet, pipe)()
+	it.from = ftr
+	hooks := ftr.hooks.Load()
+	if hooks == nil {
+		itemsOf(pipe).send(it)
+		return
+	}
+	if hooks.OnStall != nil {
+		after := hooks.StallAfter
+		if after <= 0 {
+			after = DefaultStallAfter
+		}
+		stall := time.AfterFunc(after, func() {
+			hooks.OnStall(ftr.name, pipe.Name(), after)
+		})
+		itemsOf(pipe).send(it)
+		stall.Stop()
+	} else {
+		itemsOf(pipe).send(it)
+	}
+	itemOut(&ftr.hooks, ftr.name, pipe, it)
+}
@@ -0,0 +1,126 @@
+package arch
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	nums := NewPipe("nums", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	split := NewFilterWithPipes("split", func(n int) []int {
+		return make([]int, n)
+	}, WithPipes(in), WithPipes(nums), WithLens())
+	sum := NewFilterWithPipes("sum", func(nums []int) int {
+		return len(nums)
+	}, WithPipes(nums), WithPipes(out), WithLens(NewLen(nums, nums)))
+	mtx := sync.Mutex{}
+	events := make(map[string]int)
+	record := func(event string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		events[event]++
+	}
+	model := NewModel(WithFilters(split, sum), WithPipes(in), WithPipes(out))
+	model.SetHooks(Hooks{
+		OnFilterStart: func(filter string) { record("start " + filter) },
+		OnItemIn:      func(filter, pipe string, seq uint64) { record("in " + filter + " " + pipe) },
+		OnItemOut:     func(filter, pipe string, seq uint64) { record("out " + filter + " " + pipe) },
+	})
+	model.Run()
+	defer model.Stop()
+	if output := model.Call(WithInput(3)); output[0] != 3 {
+		t.Fatal(output)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if events["start split"] != 1 || events["start sum"] != 1 {
+		t.Fatal(events)
+	}
+	if events["in split in"] != 1 || events["out split nums"] != 3 || events["in sum nums"] != 3 {
+		t.Fatal(events)
+	}
+	//The model sends its inputs and receives its outputs outside the filters
+	if events["out  in"] != 1 || events["in  out"] != 1 {
+		t.Fatal(events)
+	}
+}
+
+func TestHooksSetGet(t *testing.T) {
+	pipes := []Pipe{
+		NewPipe("pipe", int(0), 1),
+		NewMergePipe("merge", int(0), 1, MergeArrival),
+		NewBalancedPipe("balanced", int(0), 1, RoundRobin()),
+	}
+	for _, pipe := range pipes {
+		events := make(chan string, 2)
+		pipe.To(nil)
+		itemsOf(pipe).setHooks(&Hooks{
+			OnItemIn:  func(filter, pipe string, seq uint64) { events <- "in " + filter + " " + pipe },
+			OnItemOut: func(filter, pipe string, seq uint64) { events <- "out " + filter + " " + pipe },
+		})
+		pipe.Set(1)
+		if n := pipe.Get(nil); n != 1 {
+			t.Fatal(pipe.Name(), n)
+		}
+		if out, in := <-events, <-events; out != "out  "+pipe.Name() || in != "in  "+pipe.Name() {
+			t.Fatal(out, in)
+		}
+	}
+}
+
+func TestHooksStall(t *testing.T) {
+	nums := NewPipe("nums", int(0), 1)
+	n := 0
+	source := NewSourceFilter("nums", func() (int, bool) {
+		n++
+		return n, n <= 3
+	}, WithPipes(nums))
+	sink := NewSinkFilter("slow", func(int) {
+		time.Sleep(time.Millisecond * 20)
+	}, WithPipes(nums), WithLens())
+	stalls := make(chan string, 10)
+	model := NewModel(WithFilters(source, sink), WithPipes(), WithPipes())
+	model.SetHooks(Hooks{
+		OnStall: func(filter, pipe string, blocked time.Duration) {
+			stalls <- filter + " " + pipe
+		},
+		StallAfter: time.Millisecond * 5,
+	})
+	model.Run()
+	model.Wait()
+	select {
+	case stall := <-stalls:
+		if stall != "nums nums" {
+			t.Fatal(stall)
+		}
+	default:
+		t.Fatal("producer blocked on a full buffer must stall")
+	}
+}
+
+func TestHooksWhileRunning(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	inc := NewFilterWithPipes("inc", func(n int) int {
+		return n + 1
+	}, WithPipes(in), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(inc), WithPipes(in), WithPipes(out))
+	model.Run()
+	defer model.Stop()
+	done := make(chan int)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			model.SetHooks(Hooks{OnItemIn: func(filter, pipe string, seq uint64) {}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if output := model.Call(WithInput(i)); output[0] != i+1 {
+			t.Fatal(output)
+		}
+	}
+	<-done
+}
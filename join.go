@@ -0,0 +1,242 @@
+package arch
+
+import (
+	"reflect"
+	"time"
+)
+
+// Pair of items matched by a keyed join
+type Pair[L, R any] struct {
+	Left  L
+	Right R
+}
+
+// Options of a keyed join
+type JoinOptions struct {
+	Timeout        time.Duration //Time an item waits for its match, zero means no timeout
+	Limit          int           //Max items waiting for a match in every side, zero means no limit
+	UnmatchedLeft  Pipe          //Pipe for left items without match, nil to drop them
+	UnmatchedRight Pipe          //Pipe for right items without match, nil to drop them
+}
+
+// Item waiting for its match
+type joining struct {
+	it      *item
+	key     string
+	arrival time.Time
+	done    bool
+}
+
+// Side of a keyed join
+type joinSide struct {
+	ftr       *filter //Join filter, it sends unmatched items
+	in        Pipe
+	unmatched Pipe
+	key       func(data any) string
+	byKey     map[string][]*joining
+	order     []*joining //Items in arrival order, it's used for timeouts and limit
+	waiting   int
+}
+
+// Represents a filter that pairs items of two pipes by key
+type keyedJoin struct {
+	*filter
+	left, right *joinSide
+	matched     Pipe
+	pair        func(left, right any) any
+	timeout     time.Duration
+	limit       int
+}
+
+// Create a filter that pairs items from left and right pipes with the same key and sends a Pair[L, R] through
+// matched pipe. Items wait for their match in arrival order, when they wait longer than the timeout or when
+// there are more waiting items than the limit, the oldest ones are sent to the unmatched pipes.
+//
+// It's useful for enriching events with lookups that arrive out of order, pairs are sent as they are
+// matched, so it's used in models driven by source filters or in branches that end in sink filters.
+func NewKeyedJoin[L, R any](name string, left, right, matched Pipe, leftKey func(L) string, rightKey func(R) string, opts JoinOptions) Filter {
+	leftType := reflect.TypeOf((*L)(nil)).Elem()
+	rightType := reflect.TypeOf((*R)(nil)).Elem()
+	outTypes := []reflect.Type{reflect.TypeOf(Pair[L, R]{})}
+	outs := WithPipes(matched)
+	if opts.UnmatchedLeft != nil {
+		outTypes = append(outTypes, leftType)
+		outs = append(outs, opts.UnmatchedLeft)
+	}
+	if opts.UnmatchedRight != nil {
+		outTypes = append(outTypes, rightType)
+		outs = append(outs, opts.UnmatchedRight)
+	}
+	//Function is never called, it describes join for the model checks
+	fnType := reflect.FuncOf([]reflect.Type{leftType, rightType}, outTypes, false)
+	fn := reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, len(outTypes))
+		for i := range results {
+			results[i] = reflect.Zero(outTypes[i])
+		}
+		return results
+	})
+	ftr := NewFilterWithPipes(name, fn.Interface(), WithPipes(left, right), outs, WithLens())
+	return &keyedJoin{
+		filter:  baseOf(ftr),
+		left:    newJoinSide(baseOf(ftr), left, opts.UnmatchedLeft, func(data any) string { return leftKey(data.(L)) }),
+		right:   newJoinSide(baseOf(ftr), right, opts.UnmatchedRight, func(data any) string { return rightKey(data.(R)) }),
+		matched: matched,
+		pair: func(left, right any) any {
+			return Pair[L, R]{Left: left.(L), Right: right.(R)}
+		},
+		timeout: opts.Timeout,
+		limit:   opts.Limit,
+	}
+}
+
+func newJoinSide(ftr *filter, in, unmatched Pipe, key func(data any) string) *joinSide {
+	return &joinSide{
+		ftr:       ftr,
+		in:        in,
+		unmatched: unmatched,
+		key:       key,
+		byKey:     make(map[string][]*joining),
+		order:     make([]*joining, 0, 10),
+	}
+}
+
+// Take the oldest item waiting for key
+func (side *joinSide) take(key string) *joining {
+	queue := side.byKey[key]
+	if len(queue) == 0 {
+		return nil
+	}
+	waiting := queue[0]
+	if len(queue) == 1 {
+		delete(side.byKey, key)
+	} else {
+		side.byKey[key] = queue[1:]
+	}
+	waiting.done = true
+	side.waiting--
+	side.compact()
+	return waiting
+}
+
+// Remove taken items from arrival order, the oldest item of order is always waiting. Taken items behind it are
+// removed when they are most of order, so order doesn't grow with items that were matched.
+func (side *joinSide) compact() {
+	for len(side.order) > 0 && side.order[0].done {
+		side.order = side.order[1:]
+	}
+	if len(side.order) <= 2*side.waiting {
+		return
+	}
+	order := make([]*joining, 0, 2*side.waiting+10)
+	for _, waiting := range side.order {
+		if !waiting.done {
+			order = append(order, waiting)
+		}
+	}
+	side.order = order
+}
+
+// Add item to wait for its match
+func (side *joinSide) wait(it *item, key string) {
+	waiting := &joining{it: it, key: key, arrival: time.Now()}
+	side.byKey[key] = append(side.byKey[key], waiting)
+	side.order = append(side.order, waiting)
+	side.waiting++
+}
+
+// Send to unmatched pipe the oldest items while expired tells that they must not wait anymore
+func (side *joinSide) expire(expired func(waiting *joining) bool) {
+	for len(side.order) > 0 {
+		//The oldest item is the first item waiting for its key, taking it removes it from order
+		waiting := side.order[0]
+		if !expired(waiting) {
+			return
+		}
+		side.take(waiting.key)
+		if side.unmatched != nil {
+			//Received items are shared with the other filters of the pipe
+			unmatched := *waiting.it
+			side.ftr.sendItem(side.unmatched, &unmatched)
+		}
+	}
+}
+
+// Run join, waiting items are sent to unmatched pipes when input pipes are closed
+func (join *keyedJoin) Run() {
+	ftr := join.filter
+	if !ftr.compiled {
+		panic(ErrFilterNotCompiled)
+	}
+	ftr.started()
+	defer ftr.stopped()
+	defer ftr.closeInputs()
+	defer ftr.output.Close()
+	lefts, rights := itemsOf(join.left.in).channel(ftr), itemsOf(join.right.in).channel(ftr)
+	var stop chan int
+	if ftr.sg != nil {
+		stop = ftr.sg.stop
+	}
+	var expire <-chan time.Time
+	if join.timeout > 0 {
+		//Items expire within 10ms of their timeout
+		ticker := time.NewTicker(time.Millisecond * 10)
+		defer ticker.Stop()
+		expire = ticker.C
+	}
+	for lefts != nil || rights != nil {
+		select {
+		case it, ok := <-lefts:
+			if !ok {
+				lefts = nil
+			} else {
+				ftr.arrived(join.left.in, it)
+				join.receive(it, join.left, join.right, false)
+			}
+		case it, ok := <-rights:
+			if !ok {
+				rights = nil
+			} else {
+				ftr.arrived(join.right.in, it)
+				join.receive(it, join.right, join.left, true)
+			}
+		case <-stop:
+			return
+		case now := <-expire:
+			expired := func(waiting *joining) bool {
+				return now.Sub(waiting.arrival) >= join.timeout
+			}
+			join.left.expire(expired)
+			join.right.expire(expired)
+		}
+	}
+	all := func(*joining) bool { return true }
+	join.left.expire(all)
+	join.right.expire(all)
+}
+
+// Match item with the oldest item of the other side with the same key or make it wait
+func (join *keyedJoin) receive(it *item, side, other *joinSide, isRight bool) {
+	if it.data == nil {
+		return //skipped items have no key
+	}
+	defer join.counters.end(join.counters.begin())
+	join.share.acquire()
+	key := side.key(it.data)
+	join.share.release()
+	match := other.take(key)
+	if match == nil {
+		side.wait(it, key)
+		if join.limit > 0 {
+			side.expire(func(*joining) bool { return side.waiting > join.limit })
+		}
+		return
+	}
+	left, right := match.it, it
+	if !isRight {
+		left, right = it, match.it
+	}
+	head := left.header.merge(right.header)
+	head.ticket = 0 //pairs join items of two tickets
+	join.sendItem(join.matched, &item{data: join.pair(left.data, right.data), header: head})
+}
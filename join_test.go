@@ -0,0 +1,93 @@
+package arch
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestKeyedJoin(t *testing.T) {
+	type Event struct {
+		User string
+		Page string
+	}
+	type Profile struct {
+		User    string
+		Country string
+	}
+	events := NewPipe("events", Event{}, 1)
+	profiles := NewPipe("profiles", Profile{}, 1)
+	enriched := NewPipe("enriched", Pair[Event, Profile]{}, 1)
+	lonelyEvents := NewPipe("lonelyEvents", Event{}, 1)
+	lonelyProfiles := NewPipe("lonelyProfiles", Profile{}, 1)
+
+	join := NewKeyedJoin("enrich", events, profiles, enriched,
+		func(event Event) string { return event.User },
+		func(profile Profile) string { return profile.User },
+		JoinOptions{
+			Timeout:        time.Millisecond * 30,
+			UnmatchedLeft:  lonelyEvents,
+			UnmatchedRight: lonelyProfiles,
+		},
+	)
+	results := make(chan string, 10)
+	matchedSink := NewSinkFilter("matched", func(pair Pair[Event, Profile]) {
+		results <- fmt.Sprint("matched ", pair.Left.Page, " ", pair.Right.Country)
+	}, WithPipes(enriched), WithLens())
+	eventSink := NewSinkFilter("lonelyEvents", func(event Event) {
+		results <- fmt.Sprint("event ", event.User)
+	}, WithPipes(lonelyEvents), WithLens())
+	profileSink := NewSinkFilter("lonelyProfiles", func(profile Profile) {
+		results <- fmt.Sprint("profile ", profile.User)
+	}, WithPipes(lonelyProfiles), WithLens())
+
+	model := NewModel(WithFilters(join, matchedSink, eventSink, profileSink), WithPipes(events, profiles), WithPipes())
+	sent := make(chan string, 100)
+	join.SetHooks(Hooks{OnItemOut: func(filter, pipe string, seq uint64) {
+		sent <- filter + " " + pipe
+	}})
+	model.Run()
+	model.Call(WithInput(Event{"ana", "home"}, Profile{"bob", "es"}))
+	model.Call(WithInput(Event{"bob", "cart"}, Profile{"ana", "cu"}))
+	model.Call(WithInput(Event{"carl", "home"}, Profile{"dora", "mx"}))
+	received := make([]string, 4)
+	for i := range received {
+		received[i] = <-results
+	}
+	sort.Strings(received)
+	expected := "[event carl matched cart es matched home cu profile dora]"
+	if fmt.Sprint(received) != expected {
+		t.Fatal(received)
+	}
+	//Unmatched items are sent by the join like pairs
+	reported := make([]string, 4)
+	for i := range reported {
+		reported[i] = <-sent
+	}
+	sort.Strings(reported)
+	if fmt.Sprint(reported) != "[enrich enriched enrich enriched enrich lonelyEvents enrich lonelyProfiles]" {
+		t.Fatal(reported)
+	}
+	model.Stop()
+}
+
+func TestJoinOrderCompact(t *testing.T) {
+	side := newJoinSide(nil, NewPipe("in", "", 1), nil, func(data any) string { return data.(string) })
+	//An item that never finds its match stays at the head of order
+	side.wait(&item{data: "lonely"}, "lonely")
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprint(i)
+		side.wait(&item{data: key}, key)
+		if side.take(key) == nil {
+			t.Fatal("item ", key, " not waiting")
+		}
+	}
+	if side.waiting != 1 || len(side.order) > 3 {
+		t.Fatal("matched items kept in order: ", len(side.order), " waiting: ", side.waiting)
+	}
+	side.expire(func(*joining) bool { return true })
+	if side.waiting != 0 || len(side.order) != 0 {
+		t.Fatal("expired items kept in order: ", len(side.order), " waiting: ", side.waiting)
+	}
+}
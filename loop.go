@@ -0,0 +1,98 @@
+package arch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// It's produced with panic when a loop has no predicate and no max iteration count, it would never exit
+var ErrLoopUnbounded = errors.New("loop has no predicate and no max iteration count")
+
+// Represents a controlled feedback loop for iterative algorithms.
+//
+// The loop receives a state from its input pipe and feeds it to the body, a model with one input and one output
+// of the same type, the output of the body is fed back into its input until the predicate is true or the max
+// iteration count is reached, then the state exits through the output pipe of the loop.
+//
+// The body runs as a model of its own, so the feedback never makes a cycle in the graph of the outer model and
+// the deadlock analysis of NewModel applies to the body and to the outer model separately.
+type loop struct {
+	*filter
+	body Model
+}
+
+// Create a loop filter, until is called with the state returned by the body and the number of iterations,
+// maxIterations lesser than or equal to zero means no limit
+func NewLoop[T any](name string, in, out Pipe, body Model, until func(state T, iterations int) bool, maxIterations int) Filter {
+	if until == nil && maxIterations <= 0 {
+		panic(ErrLoopUnbounded)
+	}
+	stateType := reflect.TypeOf((*T)(nil)).Elem()
+	md := body.(*model)
+	if len(md.inputs) != 1 || len(md.outpus) != 1 {
+		panic(fmt.Errorf("loop '%s' body must have one input and one output", name))
+	}
+	if md.inputs[0].CheckType() != stateType || md.outpus[0].CheckType() != stateType {
+		panic(fmt.Errorf("loop '%s' body input and output must be of type '%s'", name, stateType))
+	}
+	if md.inputs[0] == in || md.outpus[0] == out || md.inputs[0] == out || md.outpus[0] == in {
+		panic(fmt.Errorf("loop '%s' input and output pipes must not be pipes of its body", name))
+	}
+	//Calls to the body carry the metadata of the call of the outer model
+	ftr := NewFilterWithPipes(name, func(meta Metadata, state T) (T, error) {
+		for i := 1; maxIterations <= 0 || i <= maxIterations; i++ {
+			output := body.Call(WithInput(state), WithMeta(meta))[0]
+			if output == nil {
+				return state, fmt.Errorf("loop '%s' body failed at iteration %d", name, i)
+			}
+			state = output.(T)
+			if until != nil && until(state, i) {
+				break
+			}
+		}
+		return state, nil
+	},
+		WithPipes(in),
+		WithPipes(out),
+		WithLens(),
+	)
+	return &loop{
+		filter: baseOf(ftr),
+		body:   body,
+	}
+}
+
+// Run body and loop filter, body is stopped when the loop filter finishes
+func (lp *loop) Run() {
+	lp.body.Run()
+	defer lp.body.Stop()
+	lp.filter.Run()
+}
+
+// Set hooks of loop filter and its body
+func (lp *loop) SetHooks(hooks Hooks) {
+	lp.filter.SetHooks(hooks)
+	lp.body.SetHooks(hooks)
+}
+
+// Errors of loop filter and its body
+func (lp *loop) Errs() []error {
+	errs := append([]error{}, lp.filter.Errs()...)
+	return append(errs, lp.body.Errs()...)
+}
+
+func (lp *loop) HasErrs() bool {
+	return lp.filter.HasErrs() || lp.body.HasErrs()
+}
+
+func (lp *loop) PrintErrs() {
+	for _, err := range lp.Errs() {
+		fmt.Println(err)
+	}
+}
+
+func (lp *loop) Clear() {
+	lp.filter.Clear()
+	lp.body.Clear()
+}
@@ -0,0 +1,82 @@
+package arch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLoop(t *testing.T) {
+	guess := NewPipe("guess", float64(0), 1)
+	improved := NewPipe("improved", float64(0), 1)
+	newton := NewFilterWithPipes("newton", func(x float64) float64 {
+		return (x + 2/x) / 2
+	},
+		WithPipes(guess),
+		WithPipes(improved),
+		WithLens(),
+	)
+	body := NewModel(WithFilters(newton), WithPipes(guess), WithPipes(improved))
+
+	input := NewPipe("input", float64(0), 1)
+	sqrt := NewPipe("sqrt", float64(0), 1)
+	iterations := 0
+	loop := NewLoop("sqrt2", input, sqrt, body, func(x float64, i int) bool {
+		iterations = i
+		return math.Abs(x*x-2) < 1e-12
+	}, 100)
+	model := NewModel(WithFilters(loop), WithPipes(input), WithPipes(sqrt))
+	model.Run()
+	result := model.Call(WithInput(1.0))[0].(float64)
+	model.Stop()
+	if math.Abs(result-math.Sqrt2) > 1e-9 {
+		t.Fatal(result)
+	}
+	if iterations == 0 || iterations == 100 {
+		t.Fatal("loop didn't exit by predicate: ", iterations)
+	}
+	if model.HasErrs() {
+		model.PrintErrs()
+		t.Fail()
+	}
+}
+
+func TestLoopMaxIterations(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	inc := NewFilterWithPipes("inc", func(n int) int { return n + 1 }, WithPipes(in), WithPipes(out), WithLens())
+	body := NewModel(WithFilters(inc), WithPipes(in), WithPipes(out))
+
+	input := NewPipe("input", int(0), 1)
+	output := NewPipe("output", int(0), 1)
+	loop := NewLoop[int]("count", input, output, body, nil, 7)
+	model := NewModel(WithFilters(loop), WithPipes(input), WithPipes(output))
+	model.Run()
+	if result := model.Call(WithInput(0))[0]; result != 7 {
+		t.Fatal(result)
+	}
+	model.Stop()
+}
+
+func TestLoopMetadata(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	tenants := make(chan string, 3)
+	inc := NewFilterWithPipes("inc", func(meta Metadata, n int) int {
+		tenants <- meta.Get("tenant")
+		return n + 1
+	}, WithPipes(in), WithPipes(out), WithLens())
+	body := NewModel(WithFilters(inc), WithPipes(in), WithPipes(out))
+
+	input := NewPipe("input", int(0), 1)
+	output := NewPipe("output", int(0), 1)
+	loop := NewLoop[int]("count", input, output, body, nil, 3)
+	model := NewModel(WithFilters(loop), WithPipes(input), WithPipes(output))
+	model.Run()
+	defer model.Stop()
+	model.Call(WithInput(0), WithMeta(NewMetadata("tenant", "t1")))
+	for i := 0; i < 3; i++ {
+		if tenant := <-tenants; tenant != "t1" {
+			t.Fatal("body calls must carry the metadata of the outer call", tenant)
+		}
+	}
+}
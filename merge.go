@@ -0,0 +1,135 @@
+package arch
+
+import "sync"
+
+// Ordering semantics of a merge pipe
+type MergeMode int
+
+const (
+	// Items are sent as they arrive from any producer, skipped items too, so consumers receive every item of every
+	// producer and skip their function for skipped items. It's useful for models driven by source filters or for
+	// branches that end in sink filters.
+	MergeArrival MergeMode = iota
+	// The pipe waits for the item of every producer for the same call and sends only one item: the valid item of
+	// the first producer in the order producers were compiled (items sent without a filter go last), or a skipped
+	// item if every producer skipped it. This way the merged item belongs to the right Model.Call and it doesn't
+	// depend on which producer finished first.
+	MergeCorrelated
+	// Every item is sent once in the order it was sent by the balanced pipe upstream, it's used to reassemble
+	// the results of replicas of a filter fed by a balanced pipe. Items that don't come from a balanced pipe are
+	// sent as they arrive.
+	MergeOrdered
+)
+
+// Pipe with several producers, it's used to converge alternative branches into one pipe
+type mergePipe struct {
+	*pipe
+	mode      MergeMode
+	producers []Filter //Filters that send items in the order they were compiled
+	pending   map[uint64]*merging
+	waiting   map[uint64]*item //Items waiting for previous tickets in MergeOrdered mode
+	next      uint64           //Next ticket to send in MergeOrdered mode
+	mtxMerge  sync.Mutex
+}
+
+// Items received from producers for one call
+type merging struct {
+	count int
+	first *item //Valid item of the first producer
+	rank  int   //Position of the producer of first
+	head  header
+}
+
+// Create a pipe that accepts items from several filters, mode sets the order of the items sent
+func NewMergePipe(name string, checkType any, buffer int, mode MergeMode) Pipe {
+	return &mergePipe{
+		pipe:    newPipe(name, checkType, buffer),
+		mode:    mode,
+		pending: make(map[uint64]*merging),
+		waiting: make(map[uint64]*item),
+		next:    1,
+	}
+}
+
+// Register a filter that sends items to pipe, it's called on filter compilation
+func (mp *mergePipe) from(filter Filter) {
+	mp.mtxMerge.Lock()
+	defer mp.mtxMerge.Unlock()
+	if mp.rank(filter) == len(mp.producers) {
+		mp.producers = append(mp.producers, filter)
+	}
+}
+
+// Position of the producer of an item, items without a known producer go last
+func (mp *mergePipe) rank(filter Filter) int {
+	for i := range mp.producers {
+		if mp.producers[i] == filter {
+			return i
+		}
+	}
+	return len(mp.producers)
+}
+
+// Send data through pipe
+func (mp *mergePipe) Set(data any) {
+	it := &item{data: data}
+	mp.send(it)
+	itemOut(&mp.hooks, "", mp, it)
+}
+
+// Send item through pipe according to merge mode
+func (mp *mergePipe) send(it *item) {
+	if mp.mode == MergeArrival {
+		mp.pipe.send(it)
+		return
+	}
+	mp.mtxMerge.Lock()
+	defer mp.mtxMerge.Unlock()
+	if mp.mode == MergeOrdered {
+		mp.reorder(it)
+		return
+	}
+	if len(mp.producers) <= 1 {
+		mp.pipe.send(it)
+		return
+	}
+	m, ok := mp.pending[it.seq]
+	if !ok {
+		m = &merging{}
+		mp.pending[it.seq] = m
+	}
+	m.count++
+	m.head = m.head.merge(it.header)
+	if rank := mp.rank(it.from); it.data != nil && (m.first == nil || rank < m.rank) {
+		m.first, m.rank = it, rank
+	}
+	if m.count < len(mp.producers) {
+		return
+	}
+	delete(mp.pending, it.seq)
+	if m.first != nil {
+		mp.pipe.send(&item{data: m.first.data, header: m.head})
+	} else {
+		mp.pipe.send(&item{header: m.head})
+	}
+}
+
+// Send items in the order of their tickets
+func (mp *mergePipe) reorder(it *item) {
+	if it.ticket == 0 {
+		mp.pipe.send(it)
+		return
+	}
+	mp.waiting[it.ticket] = it
+	for {
+		next, ok := mp.waiting[mp.next]
+		if !ok {
+			return
+		}
+		delete(mp.waiting, mp.next)
+		mp.next++
+		sent := *next
+		sent.ticket = 0 //order is restored, next merges must not wait for it
+		mp.pipe.send(&sent)
+	}
+}
@@ -0,0 +1,110 @@
+package arch
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeCorrelated(t *testing.T) {
+	input := NewPipe("input", int(0), 1)
+	small := NewPipe("small", int(0), 1)
+	big := NewPipe("big", int(0), 1)
+	merged := NewMergePipe("merged", "", 1, MergeCorrelated)
+
+	router := NewRouter("size", input,
+		When(small, func(n int) bool { return n < 5 }),
+		Otherwise[int](big),
+	)
+	smallFilter := NewFilterWithPipes("small", func(n int) string {
+		time.Sleep(time.Millisecond * 2)
+		return fmt.Sprint("small ", n)
+	},
+		WithPipes(small),
+		WithPipes(merged),
+		WithLens(),
+	)
+	bigFilter := NewFilterWithPipes("big", func(n int) string {
+		return fmt.Sprint("big ", n)
+	},
+		WithPipes(big),
+		WithPipes(merged),
+		WithLens(),
+	)
+	model := NewModel(WithFilters(router, smallFilter, bigFilter), WithPipes(input), WithPipes(merged))
+	model.Run()
+	results := make([]string, 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = model.Call(WithInput(i))[0].(string)
+		}(i)
+	}
+	wg.Wait()
+	model.Stop()
+	for i := range results {
+		expected := fmt.Sprint("big ", i)
+		if i < 5 {
+			expected = fmt.Sprint("small ", i)
+		}
+		if results[i] != expected {
+			t.Fatal(results[i], " != ", expected)
+		}
+	}
+}
+
+func TestMergeRequired(t *testing.T) {
+	input := NewPipe("input", int(0), 1)
+	output := NewPipe("output", int(0), 1)
+	first := NewFilterWithPipes("first", func(n int) int { return n }, WithPipes(input), WithPipes(output), WithLens())
+	second := NewFilterWithPipes("second", func(n int) int { return n }, WithPipes(input), WithPipes(output), WithLens())
+	defer func() {
+		if recover() == nil {
+			t.Fatal("pipe with two producers must be a merge pipe")
+		}
+	}()
+	NewModel(WithFilters(first, second), WithPipes(input), WithPipes(output))
+}
+
+func TestMergeCorrelatedProducerOrder(t *testing.T) {
+	input := NewPipe("input", int(0), 1)
+	merged := NewMergePipe("merged", "", 1, MergeCorrelated)
+	slow := NewFilterWithPipes("slow", func(n int) string {
+		time.Sleep(time.Millisecond * 2)
+		return fmt.Sprint("slow ", n)
+	}, WithPipes(input), WithPipes(merged), WithLens())
+	fast := NewFilterWithPipes("fast", func(n int) string {
+		return fmt.Sprint("fast ", n)
+	}, WithPipes(input), WithPipes(merged), WithLens())
+	model := NewModel(WithFilters(slow, fast), WithPipes(input), WithPipes(merged))
+	model.Run()
+	defer model.Stop()
+	for i := 0; i < 5; i++ {
+		if result := model.Call(WithInput(i))[0]; result != fmt.Sprint("slow ", i) {
+			t.Fatal("the valid item of the first compiled producer must be sent", result)
+		}
+	}
+}
+
+func TestMergeArrivalSkipped(t *testing.T) {
+	input := NewPipe("input", int(0), 1)
+	merged := NewMergePipe("merged", int(0), 1, MergeArrival)
+	even := NewFilterWithPipes("even", func(n int) Optional[int] {
+		if n%2 == 0 {
+			return Some(n)
+		}
+		return None[int]()
+	}, WithPipes(input), WithPipes(merged), WithLens())
+	model := NewModel(WithFilters(even), WithPipes(input), WithPipes(merged))
+	model.Run()
+	defer model.Stop()
+	for i := 0; i < 4; i++ {
+		result := model.Call(WithInput(i))[0]
+		if i%2 == 0 && result != i || i%2 == 1 && result != nil {
+			t.Fatal("skipped items must be forwarded to keep calls correlated", i, result)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package arch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+)
+
+// It's produced with panic when metadata is created with a key without value
+var ErrMetadataOddPairs = errors.New("metadata requires pairs of key and value")
+
+// Type of Metadata, used to detect metadata parameters in filter functions
+var metadataType = reflect.TypeOf(Metadata{})
+
+// Type of context.Context, used to detect context parameters in filter functions
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Key used to store metadata in a context
+type metadataKey struct{}
+
+// Represents an immutable set of key/value pairs that travels with every item sent by a call to the model.
+//
+// It's useful to propagate tenant IDs, request IDs or trace IDs to every filter involved in a call.
+// A filter function can read it declaring a parameter of type Metadata or context.Context.
+type Metadata struct {
+	values map[string]string
+}
+
+// Create metadata from pairs of key and value, it makes panic if the number of arguments is odd
+func NewMetadata(pairs ...string) Metadata {
+	if len(pairs)%2 != 0 {
+		panic(ErrMetadataOddPairs)
+	}
+	if len(pairs) == 0 {
+		return Metadata{}
+	}
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+	return Metadata{values: values}
+}
+
+// Get the value for key, it returns an empty string if key is not found
+func (meta Metadata) Get(key string) string {
+	return meta.values[key]
+}
+
+// Get the value for key and tell if it was found
+func (meta Metadata) Lookup(key string) (string, bool) {
+	value, ok := meta.values[key]
+	return value, ok
+}
+
+// Number of keys
+func (meta Metadata) Len() int {
+	return len(meta.values)
+}
+
+// Sorted keys
+func (meta Metadata) Keys() []string {
+	keys := make([]string, 0, len(meta.values))
+	for key := range meta.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Create a copy of metadata with key set to value
+func (meta Metadata) With(key, value string) Metadata {
+	values := make(map[string]string, len(meta.values)+1)
+	for k, v := range meta.values {
+		values[k] = v
+	}
+	values[key] = value
+	return Metadata{values: values}
+}
+
+// Create a copy of metadata with keys of other that are not present in meta.
+// On conflict the value of meta is kept.
+func (meta Metadata) Merge(other Metadata) Metadata {
+	if len(other.values) == 0 {
+		return meta
+	}
+	if len(meta.values) == 0 {
+		return other
+	}
+	merged := meta
+	copied := false
+	for k, v := range other.values {
+		if _, ok := meta.values[k]; ok {
+			continue
+		}
+		if !copied {
+			merged = meta.With(k, v)
+			copied = true
+		} else {
+			merged.values[k] = v
+		}
+	}
+	return merged
+}
+
+// Copy of metadata as a map
+func (meta Metadata) Map() map[string]string {
+	values := make(map[string]string, len(meta.values))
+	for k, v := range meta.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Create a context with metadata
+func ContextWithMetadata(ctx context.Context, meta Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, meta)
+}
+
+// Get metadata from a context, it returns empty metadata if context has no metadata
+func MetadataFrom(ctx context.Context) Metadata {
+	if ctx == nil {
+		return Metadata{}
+	}
+	meta, _ := ctx.Value(metadataKey{}).(Metadata)
+	return meta
+}
+
+// Merge metadata in order, values of first metadata are kept on conflict
+func mergeMeta(metas ...Metadata) Metadata {
+	merged := Metadata{}
+	for i := range metas {
+		merged = merged.Merge(metas[i])
+	}
+	return merged
+}
+
+// Tell if a function parameter type is injected by the filter instead of being received from a pipe
+func isInjected(paramType reflect.Type) bool {
+	return paramType == metadataType || paramType == contextType || paramType == stateType
+}
+
+// Options used to call a model
+type CallOption func(opts *callOptions)
+
+type callOptions struct {
+	meta     Metadata
+	priority int
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	options := &callOptions{}
+	for i := range opts {
+		opts[i](options)
+	}
+	return options
+}
+
+// Set metadata that will be propagated to every filter involved in the call
+func WithMeta(meta Metadata) CallOption {
+	return func(opts *callOptions) {
+		opts.meta = meta.Merge(opts.meta)
+	}
+}
@@ -0,0 +1,104 @@
+package arch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	a := NewPipe("a", int(0), 1)
+	b := NewPipe("b", int(0), 1)
+	sum := NewPipe("sum", int(0), 1)
+	out := NewPipe("out", "", 1)
+
+	adder := NewFilterWithPipes("adder", func(meta Metadata, a, b int) int {
+		if meta.Get("tenant") == "" {
+			panic(fmt.Errorf("metadata not received"))
+		}
+		return a + b
+	},
+		WithPipes(a, b),
+		WithPipes(sum),
+		WithLens(),
+	)
+	printer := NewFilterWithPipes("printer", func(sum int, ctx context.Context) string {
+		meta := MetadataFrom(ctx)
+		return fmt.Sprintf("%s:%s:%d", meta.Get("tenant"), meta.Get("request"), sum)
+	},
+		WithPipes(sum),
+		WithPipes(out),
+		WithLens(),
+	)
+	model := NewModel(WithFilters(adder, printer), WithPipes(a, b), WithPipes(out))
+	model.Run()
+	for i := 0; i < 5; i++ {
+		meta := NewMetadata("tenant", fmt.Sprint("t", i), "request", fmt.Sprint("r", i))
+		result := model.Call(WithInput(i, i), WithMeta(meta))[0].(string)
+		if result != fmt.Sprintf("t%d:r%d:%d", i, i, 2*i) {
+			t.Fatal(result)
+		}
+	}
+	model.Stop()
+	if model.HasErrs() {
+		model.PrintErrs()
+		t.Fail()
+	}
+}
+
+func TestMetadataMerge(t *testing.T) {
+	first := NewMetadata("tenant", "a", "trace", "1")
+	second := NewMetadata("tenant", "b", "request", "2")
+	merged := mergeMeta(first, second)
+	if merged.Get("tenant") != "a" || merged.Get("trace") != "1" || merged.Get("request") != "2" {
+		t.Fatal(merged.Map())
+	}
+	if first.Len() != 2 || second.Len() != 2 {
+		t.Fatal("metadata was modified by merge")
+	}
+}
+
+func TestContextCancelledOnStop(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	started := make(chan int)
+	cancelled := make(chan error)
+	wait := NewFilterWithPipes("wait", func(ctx context.Context, n int) int {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return n
+	}, WithPipes(in), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(wait), WithPipes(in), WithPipes(out))
+	model.Run()
+	go model.Call(WithInput(1))
+	<-started
+	model.Stop()
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("context of filter function must be cancelled on stop")
+	}
+}
+
+// Pipe implemented outside the pipes of this package, like a mock in tests
+type foreignPipe struct {
+	Pipe
+}
+
+func TestForeignPipe(t *testing.T) {
+	var in Pipe = foreignPipe{NewPipe("in", int(0), 1)}
+	out := NewPipe("out", int(0), 1)
+	echo := NewFilterWithPipes("echo", func(n int) int { return n }, WithPipes(in), WithPipes(out), WithLens())
+	defer func() {
+		if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), "pipe 'in' must be created") {
+			t.Fatal("model must reject pipes without the item plumbing", err)
+		}
+	}()
+	NewModel(WithFilters(echo), WithPipes(in), WithPipes(out))
+}
@@ -0,0 +1,118 @@
+// Package metrics exposes the runtime statistics of a model in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	arch "github.com/stellviaproject/pipfil-arch"
+)
+
+// Content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Create a handler that renders the statistics of model in the Prometheus text format every time it's scraped.
+//
+// Filter metrics are labelled with the filter name and pipe metrics with the pipe name, buffer depth is
+// labelled with the subscriber name too.
+func Handler(model arch.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		Write(w, model.Stats())
+	})
+}
+
+// Write statistics in the Prometheus text format
+func Write(out io.Writer, stats arch.Stats) error {
+	w := bufio.NewWriter(out)
+	filters := make([]string, 0, len(stats.Filters))
+	for name := range stats.Filters {
+		filters = append(filters, name)
+	}
+	sort.Strings(filters)
+	pipes := make([]string, 0, len(stats.Pipes))
+	for name := range stats.Pipes {
+		pipes = append(pipes, name)
+	}
+	sort.Strings(pipes)
+
+	header(w, "pipfil_filter_processed_total", "counter", "Items processed by filter.")
+	for _, name := range filters {
+		sample(w, "pipfil_filter_processed_total", labels("filter", name), float64(stats.Filters[name].Processed))
+	}
+	header(w, "pipfil_filter_errors_total", "counter", "Errors added to filter.")
+	for _, name := range filters {
+		sample(w, "pipfil_filter_errors_total", labels("filter", name), float64(stats.Filters[name].Errors))
+	}
+	header(w, "pipfil_filter_in_flight", "gauge", "Items being processed by filter.")
+	for _, name := range filters {
+		sample(w, "pipfil_filter_in_flight", labels("filter", name), float64(stats.Filters[name].InFlight))
+	}
+	header(w, "pipfil_filter_latency_seconds", "histogram", "Time spent processing every item.")
+	for _, name := range filters {
+		ftr := stats.Filters[name]
+		cumulative := int64(0)
+		for i, bound := range ftr.Latency.Bounds {
+			cumulative += ftr.Latency.Counts[i]
+			sample(w, "pipfil_filter_latency_seconds_bucket", labels("filter", name, "le", formatFloat(bound.Seconds())), float64(cumulative))
+		}
+		cumulative += ftr.Latency.Counts[len(ftr.Latency.Bounds)]
+		sample(w, "pipfil_filter_latency_seconds_bucket", labels("filter", name, "le", "+Inf"), float64(cumulative))
+		sample(w, "pipfil_filter_latency_seconds_sum", labels("filter", name), ftr.Busy.Seconds())
+		sample(w, "pipfil_filter_latency_seconds_count", labels("filter", name), float64(cumulative))
+	}
+
+	header(w, "pipfil_pipe_sent_total", "counter", "Items sent through pipe.")
+	for _, name := range pipes {
+		sample(w, "pipfil_pipe_sent_total", labels("pipe", name), float64(stats.Pipes[name].Sent))
+	}
+	header(w, "pipfil_pipe_blocked_seconds_total", "counter", "Time producers spent blocked because pipe buffers were full.")
+	for _, name := range pipes {
+		sample(w, "pipfil_pipe_blocked_seconds_total", labels("pipe", name), stats.Pipes[name].Blocked.Seconds())
+	}
+	header(w, "pipfil_pipe_buffer_depth", "gauge", "Items waiting in the buffer of every pipe subscriber.")
+	for _, name := range pipes {
+		depth := stats.Pipes[name].Depth
+		subscribers := make([]string, 0, len(depth))
+		for subscriber := range depth {
+			subscribers = append(subscribers, subscriber)
+		}
+		sort.Strings(subscribers)
+		for _, subscriber := range subscribers {
+			sample(w, "pipfil_pipe_buffer_depth", labels("pipe", name, "subscriber", subscriber), float64(depth[subscriber]))
+		}
+	}
+	return w.Flush()
+}
+
+func header(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sample(w *bufio.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(value))
+}
+
+// Labels from pairs of name and value, values are escaped
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escape(pairs[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	arch "github.com/stellviaproject/pipfil-arch"
+)
+
+func TestHandler(t *testing.T) {
+	in := arch.NewPipe("in", int(0), 1)
+	out := arch.NewPipe("out", int(0), 1)
+	double := arch.NewFilterWithPipes("double", func(n int) int { return n * 2 }, arch.WithPipes(in), arch.WithPipes(out), arch.WithLens())
+	model := arch.NewModel(arch.WithFilters(double), arch.WithPipes(in), arch.WithPipes(out))
+	model.Run()
+	defer model.Stop()
+	for i := 0; i < 3; i++ {
+		model.Call(arch.WithInput(i))
+	}
+	server := httptest.NewServer(Handler(model))
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != ContentType {
+		t.Fatal(resp.Header)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE pipfil_filter_processed_total counter",
+		`pipfil_filter_processed_total{filter="double"} 3`,
+		`pipfil_filter_errors_total{filter="double"} 0`,
+		"# TYPE pipfil_filter_latency_seconds histogram",
+		`pipfil_filter_latency_seconds_bucket{filter="double",le="+Inf"} 3`,
+		`pipfil_filter_latency_seconds_count{filter="double"} 3`,
+		`pipfil_pipe_sent_total{pipe="in"} 3`,
+		`pipfil_pipe_sent_total{pipe="out"} 3`,
+		`pipfil_pipe_buffer_depth{pipe="out",subscriber=""} 0`,
+		`pipfil_pipe_buffer_depth{pipe="in",subscriber="double"} 0`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, body)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	if got := labels("filter", "a\"b\\c\nd"); got != `filter="a\"b\\c\nd"` {
+		t.Fatal(got)
+	}
+}
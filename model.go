@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // This error is produced with panic when you call model with not enough or more than required length of arguments.
@@ -13,6 +15,9 @@ var ErrInputCountMismatch = errors.New("input count mismatch")
 // This error is produced when in input or output pipes of model you have a pipe repeated
 var ErrModelInOutRepeated = errors.New("model inout repeated")
 
+// This error is produced with panic when a model has no input pipes and no source filters
+var ErrModelWithoutInput = errors.New("model has no input pipes and no source filters")
+
 // Join pipes into slice for easy filter and model creation
 func WithPipes(pipes ...Pipe) []Pipe {
 	return pipes
@@ -93,14 +98,28 @@ func WithInput(input ...any) []any {
 
 // Represents a model with pipes-filters architecture
 type Model interface {
-	Call(input []any) []any         //Call model to evaluate in algorithm with pipes-filters architecture
-	Run()                           //Run model
-	Stop()                          //Stop model
-	SetParallel(parallel int) error //Set parallel value to every filter
-	Errs() []error                  //Get model error
-	HasErrs() bool                  //Tell if model has errors
-	PrintErrs()                     //Print errors
-	Clear()                         //Clear model errors
+	Call(input []any, opts ...CallOption) []any                 //Call model to evaluate in algorithm with pipes-filters architecture
+	TryCall(input []any, opts ...CallOption) ([]any, error)     //Call model, it returns ErrOverloaded when admission control rejects the call
+	Run()                                                       //Run model
+	Stop()                                                      //Stop model, pending windows are flushed before
+	Flush()                                                     //Send pending items of every filter that holds them, like windows
+	Wait()                                                      //Wait for model stop or for every filter to finish
+	SetParallel(parallel int) error                             //Set parallel value to every filter
+	Errs() []error                                              //Get model error
+	HasErrs() bool                                              //Tell if model has errors
+	PrintErrs()                                                 //Print errors
+	Clear()                                                     //Clear model errors
+	KeyedState() map[string]map[string]any                      //Copy of state for every key of every filter with state
+	Stats() Stats                                               //Runtime statistics of filters and pipes
+	SetTracer(tracer *Tracer)                                   //Record a span for every filter invocation, it must be set before Run
+	SetHooks(hooks Hooks)                                       //Set callbacks of every filter and pipe for logging and instrumentation, they can be replaced while running
+	SetWatchdog(after time.Duration, onStall func(StallReport)) //Report filters and pipes when there is no progress for after duration, it must be set before Run
+	CheckBuffers(fanOut map[string]int) []BufferIssue           //Find filters with uneven inputs for the fan-outs of slices sent one by one
+	Autoscale(opts AutoscaleOptions)                            //Grow or shrink the workers of every filter within bounds, it must be called before Run
+	SetBudget(budget Budget)                                    //Share workers between every filter with weighted fair scheduling, it must be called before Run
+	SetAdmission(adm Admission)                                 //Limit the calls in flight, rejected calls make Call panic with ErrOverloaded, it must be called before the first call
+	SetLengthTimeout(timeout time.Duration)                     //Time a filter waits for an element of a slice before skipping its call, it must be set before Run
+	Rejected() int64                                            //Calls rejected by admission control
 }
 
 type model struct {
@@ -108,19 +127,56 @@ type model struct {
 	filters        []Filter
 	inputs, outpus []Pipe
 	inMap, outMap  map[string]int
-	calls          []chan []any
+	calls          []*pending
 	mtxIn, mtxOut  sync.Mutex
+	mtxCalls       sync.Mutex
+	seq            uint64 //Sequence of the last call
+	running        sync.WaitGroup
+	watchdog       *watchdog
+	autoscaler     *autoscaler
+	budget         Budget //Budget of SetBudget, it's shared by the autoscaler
+	admission      *admission
+	prioritized    atomic.Bool           //Set by the first call with priority
+	hooks          atomic.Pointer[Hooks] //Hooks for the items of the inputs and outputs of model
+	quit           chan int              //Closed on stop, it stops watchdog and autoscaler
+	quitOnce       sync.Once
 }
 
 // Create a new model with pipes-filters architecture
 func NewModel(filters []Filter, inputs, outpus []Pipe) Model {
-	signal := &signal{}
+	signal := newSignal()
+	//Filters and pipes of the model must be created by this package, they carry the metadata of items
 	for i := range filters {
+		ftr := baseOf(filters[i])
+		ftr.input.ForEach(func(pipe Pipe) bool {
+			itemsOf(pipe)
+			return true
+		})
+		ftr.output.ForEach(func(pipe Pipe) bool {
+			itemsOf(pipe)
+			return true
+		})
 		filters[i].SetSignal(signal)
 	}
+	for _, pipe := range append(append([]Pipe{}, inputs...), outpus...) {
+		itemsOf(pipe)
+	}
 	for i := range outpus {
 		outpus[i].To(nil)
 	}
+	// a model without inputs must be driven by source filters
+	if len(inputs) == 0 {
+		hasSource := false
+		for i := range filters {
+			if filters[i].IsSource() {
+				hasSource = true
+				break
+			}
+		}
+		if !hasSource {
+			panic(ErrModelWithoutInput)
+		}
+	}
 	// deadlock detect
 	// generate input map
 	inIndex := make(map[string]int, len(inputs))
@@ -150,13 +206,75 @@ func NewModel(filters []Filter, inputs, outpus []Pipe) Model {
 		outputMap[pipe] = i
 		outIndex[pipe.Name()] = i
 	}
+	// filters of a loop body run in the loop, they can't be filters of the model too
 	for i := range filters {
-		ftr := filters[i].(*filter)
+		if lp, ok := filters[i].(*loop); ok {
+			body := lp.body.(*model)
+			for j := range body.filters {
+				for k := range filters {
+					if baseOf(body.filters[j]) == baseOf(filters[k]) {
+						panic(fmt.Errorf("filter '%s' is in the body of loop '%s' and in the model at the same time", filters[k].Name(), lp.name))
+					}
+				}
+			}
+		}
+	}
+	// statistics, budgets and autoscale bounds index filters and pipes by name, so their names must be unique
+	filterNames := map[string]*filter{}
+	pipeNames := map[string]Pipe{}
+	named := func(pipe Pipe) bool {
+		if other, ok := pipeNames[pipe.Name()]; ok && other != pipe {
+			panic(fmt.Errorf("model has two pipes named '%s'", pipe.Name()))
+		}
+		pipeNames[pipe.Name()] = pipe
+		return true
+	}
+	for i := range inputs {
+		named(inputs[i])
+	}
+	for i := range outpus {
+		named(outpus[i])
+	}
+	for i := range filters {
+		ftr := baseOf(filters[i])
+		if other, ok := filterNames[ftr.name]; ok && other != ftr {
+			panic(fmt.Errorf("model has two filters named '%s'", ftr.name))
+		}
+		filterNames[ftr.name] = ftr
+		ftr.input.ForEach(named)
+		ftr.output.ForEach(named)
+	}
+	// only merge pipes can have several producers
+	producers := map[Pipe]int{}
+	for i := range filters {
+		ftr := baseOf(filters[i])
+		for out, link := range ftr.outLink {
+			producers[out]++
+			if _, isMerge := out.(*mergePipe); isMerge && sendsOneByOne(ftr.outs[link], out) {
+				panic(fmt.Errorf("merge pipe '%s' can't receive slice elements one by one from filter '%s'", out.Name(), ftr.name))
+			}
+		}
+	}
+	for pipe, count := range producers {
+		if _, isMerge := pipe.(*mergePipe); !isMerge && count > 1 {
+			panic(fmt.Errorf("pipe '%s' is output of %d filters, use a merge pipe for several producers", pipe.Name(), count))
+		}
+	}
+	for i := range filters {
+		ftr := baseOf(filters[i])
 		for input, length := range ftr.length {
 			linkLen, linkOut := -1, -1
 			var filterOutLen, filterOut *filter
+			//only ordered merge pipes send one item for every item sent by the pipe used as length
+			ordered := false
+			if mp, isMerge := input.(*mergePipe); isMerge {
+				if mp.mode != MergeOrdered {
+					panic(fmt.Errorf("merge pipe '%s' can't be used with pipe '%s' as length", input.Name(), length.Name()))
+				}
+				ordered = true
+			}
 			for j := range filters {
-				ftr := filters[j].(*filter)
+				ftr := baseOf(filters[j])
 				if flnk, ok := ftr.outLink[length]; ok {
 					if linkLen != -1 {
 						panic(fmt.Errorf("pipe '%s' used as length is set as output to two filters", length.Name()))
@@ -165,19 +283,24 @@ func NewModel(filters []Filter, inputs, outpus []Pipe) Model {
 					filterOutLen = ftr
 				}
 				if flnk, ok := ftr.outLink[input]; ok {
-					if linkOut != -1 {
+					if linkOut != -1 && !ordered {
 						panic(fmt.Errorf("pipe '%s' used as input associated to pipe '%s' used as length is set as output to two filters", input.Name(), input.Name()))
 					}
 					linkOut = flnk
 					filterOut = ftr
 				}
 			}
-			fOutLenType := filterOutLen.fn.fnType.Out(linkLen)
-			if fOutLenType.Kind() != reflect.Slice {
-				panic(fmt.Errorf("pipe '%s' used as length is connected to filter '%s' output whose is not slice type", length.Name(), filterOutLen.name))
+			fOutLenType := filterOutLen.outs[linkLen]
+			lenDepth := depthOf(fOutLenType, length.CheckType())
+			if lenDepth == 0 {
+				panic(fmt.Errorf("pipe '%s' used as length is connected to filter '%s' output whose is not slice or channel type", length.Name(), filterOutLen.name))
+			}
+			//nested slices receive a length for every level
+			if inDepth := depthOf(ftr.ins[ftr.inLink[input]], input.CheckType()); inDepth != lenDepth {
+				panic(fmt.Errorf("posible deadlock, pipe '%s' used as length sends %d levels of lengths but filter '%s' receives %d levels of slices from pipe '%s'", length.Name(), lenDepth, ftr.name, inDepth, input.Name()))
 			}
 			//deadlock condition
-			fOutType := filterOut.fn.fnType.Out(linkOut)
+			fOutType := filterOut.outs[linkOut]
 			if input != length && fOutType != input.CheckType() {
 				panic(fmt.Errorf("posible deadlock, pipe '%s' could not be used with a pipe '%s' as length because pipe '%s' is associated to a filter '%s' output for sending slice elements one by one", length.Name(), input.Name(), input.Name(), filterOut.name))
 			}
@@ -189,9 +312,9 @@ func NewModel(filters []Filter, inputs, outpus []Pipe) Model {
 			}
 			isFilterOutput := false
 			for j := range filters {
-				if _, ok := filters[j].(*filter).outLink[in]; ok {
+				if _, ok := baseOf(filters[j]).outLink[in]; ok {
 					if i == j {
-						panic(fmt.Errorf("pipe '%s' is connected to filter '%s' as input and output at the same time", in.Name(), ftr.name))
+						panic(fmt.Errorf("pipe '%s' is connected to filter '%s' as input and output at the same time, use NewLoop for feedback loops", in.Name(), ftr.name))
 					}
 					isFilterOutput = true
 					break
@@ -220,7 +343,7 @@ func NewModel(filters []Filter, inputs, outpus []Pipe) Model {
 			if isModelOutput {
 				link := ftr.outLink[out]
 				outType := ftr.outs[link]
-				if outType != out.CheckType() {
+				if sendsOneByOne(outType, out) {
 					panic(fmt.Errorf("filter '%s' has output pipe '%s' as model output but it trys to send one by one", ftr.name, out.Name()))
 				}
 			}
@@ -239,16 +362,27 @@ func NewModel(filters []Filter, inputs, outpus []Pipe) Model {
 			panic(fmt.Errorf("output pipe '%s' is not connected to a filter", pipe.Name()))
 		}
 	}
-	signal.stop = make(chan int, signal.count)
-	return &model{
+	md := &model{
 		singal:  signal,
 		filters: filters,
 		inputs:  inputs,
 		outpus:  outpus,
 		inMap:   inIndex,
 		outMap:  outIndex,
-		calls:   make([]chan []any, 0, 10),
+		calls:   make([]*pending, 0, 10),
+		quit:    make(chan int),
 	}
+	byCall := md.byCall()
+	for i := range filters {
+		ftr := baseOf(filters[i])
+		ftr.prioritized = &md.prioritized
+		ftr.byCall = make(map[Pipe]bool)
+		ftr.input.ForEach(func(pipe Pipe) bool {
+			ftr.byCall[pipe] = byCall[pipe]
+			return true
+		})
+	}
+	return md
 }
 
 func (md *model) Errs() []error {
@@ -283,42 +417,74 @@ func (md *model) SetParallel(parallel int) error {
 // Provided input will be redirected to every input of model in the same order.
 //
 // The order of output will be the same of provided order of output pipes in the model builder NewModel(...)
-func (md *model) Call(input []any) []any {
+//
+// Options like WithMeta(...) and WithPriority(...) are applied to every item sent by the call.
+//
+// When admission control rejects the call it makes panic with ErrOverloaded, use TryCall to get the error.
+func (md *model) Call(input []any, opts ...CallOption) []any {
+	output, err := md.TryCall(input, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return output
+}
+
+// Call model like Call, it returns ErrOverloaded when admission control rejects the call
+func (md *model) TryCall(input []any, opts ...CallOption) ([]any, error) {
 	if len(input) != len(md.inputs) {
 		panic(ErrInputCountMismatch)
 	}
+	if !md.admission.admit(md.quit) {
+		return nil, ErrOverloaded
+	}
+	defer md.admission.leave()
+	options := newCallOptions(opts)
+	if options.priority != 0 && !md.prioritized.Load() {
+		md.prioritized.Store(true)
+	}
 
 	md.mtxIn.Lock()
 	//Critical section
 	ch := make(chan []any, 1)
-	md.calls = append(md.calls, ch)
+	md.seq++
+	md.mtxCalls.Lock()
+	md.calls = append(md.calls, &pending{
+		seq:    md.seq,
+		ch:     ch,
+		output: make([]any, len(md.outpus)),
+		got:    make([]bool, len(md.outpus)),
+	})
+	md.mtxCalls.Unlock()
 
 	for i := 0; i < len(input); i++ {
-		md.inputs[i].Set(input[i])
+		it := &item{data: input[i], header: header{meta: options.meta, seq: md.seq, priority: options.priority}}
+		itemsOf(md.inputs[i]).send(it)
+		itemOut(&md.hooks, "", md.inputs[i], it)
 	}
 
 	md.mtxIn.Unlock()
-	wt := make(chan int, 1)
+	//The call doesn't wait for its gorutine, every call has one that reads one output of every output pipe
 	go func() {
 		//Critical section for outputs
 		//Every gorutine is trying to get output at the same time
+		//Outputs are set to their calls, with priorities they could be outputs of other calls
 		md.mtxOut.Lock()
-		output := make([]any, len(md.outpus))
-		for i := 0; i < len(output); i++ {
-			output[i] = md.outpus[i].Get(nil)
+		for i := range md.outpus {
+			it := itemsOf(md.outpus[i]).recv(nil)
+			itemIn(&md.hooks, "", md.outpus[i], it)
+			//Calls queue has its own lock, inputs lock could be taken by a call waiting for the pipes
+			md.mtxCalls.Lock()
+			md.deliver(i, it)
+			md.mtxCalls.Unlock()
 		}
-
-		md.mtxIn.Lock()
-		md.calls[0] <- output
-		md.calls = md.calls[1:]
-		md.mtxIn.Unlock()
+		md.mtxCalls.Lock()
+		md.complete()
+		md.mtxCalls.Unlock()
 
 		md.mtxOut.Unlock()
-		wt <- 0
 	}()
 	output := <-ch
-	<-wt
-	return output
+	return output, nil
 }
 
 func (md *model) GetIn(in any) []any {
@@ -329,12 +495,12 @@ func (md *model) GetIn(in any) []any {
 		field := inType.Field(i)
 		if pipeName, ok := field.Tag.Lookup("pipe"); ok {
 			if index, ok := md.inMap[pipeName]; ok {
-				ins[index] = inValue.Field(i)
+				ins[index] = inValue.Field(i).Interface()
 			} else {
 				panic(fmt.Errorf("pipe '%s' not found", pipeName))
 			}
 		} else if index, ok := md.inMap[field.Name]; ok {
-			ins[index] = inValue.Field(i)
+			ins[index] = inValue.Field(i).Interface()
 		}
 	}
 	for i := 0; i < len(ins); i++ {
@@ -373,24 +539,101 @@ func (md *model) SetOut(out any, outputs []any) {
 
 // Run model
 func (md *model) Run() {
+	md.running.Add(len(md.filters))
 	for i := range md.filters {
-		go md.filters[i].Run()
+		go func(ftr Filter) {
+			defer md.running.Done()
+			ftr.Run()
+		}(md.filters[i])
+	}
+	//When every filter finish, for example when source filters are exhausted, waiters are released
+	go func() {
+		md.running.Wait()
+		md.singal.(*signal).finish()
+	}()
+	if md.watchdog != nil {
+		go md.watch(md.watchdog)
+	}
+	if md.autoscaler != nil {
+		go md.autoscale(md.autoscaler)
+	}
+}
+
+// Record a span for every filter invocation with tracer, a nil tracer disables tracing. It must be set before Run.
+func (md *model) SetTracer(tracer *Tracer) {
+	for i := range md.filters {
+		baseOf(md.filters[i]).tracer = tracer
 	}
 }
 
+// Set hooks of every filter of the model and of its pipes for the items sent and received outside the filters, they
+// can be replaced while the model runs
+func (md *model) SetHooks(hooks Hooks) {
+	md.hooks.Store(&hooks)
+	set := func(pipe Pipe) bool {
+		itemsOf(pipe).setHooks(&hooks)
+		return true
+	}
+	for i := range md.inputs {
+		set(md.inputs[i])
+	}
+	for i := range md.outpus {
+		set(md.outpus[i])
+	}
+	for i := range md.filters {
+		md.filters[i].SetHooks(hooks)
+		md.filters[i].Input().ForEach(set)
+		md.filters[i].Output().ForEach(set)
+	}
+}
+
+// Copy of state for every key of every filter with state, it's indexed by filter name
+func (md *model) KeyedState() map[string]map[string]any {
+	states := make(map[string]map[string]any)
+	for i := range md.filters {
+		if state := md.filters[i].KeyedState(); len(state) > 0 {
+			states[md.filters[i].Name()] = state
+		}
+	}
+	return states
+}
+
 func (md *model) Clear() {
 	for i := range md.filters {
 		md.filters[i].Clear()
 	}
 }
 
-// Wait for model stop or error
+// Wait for model stop or for every filter to finish
 func (md *model) Wait() {
 	md.singal.Wait()
 }
 
-// Stop model
+// Send pending items of every filter that holds them, like windows
+func (md *model) Flush() {
+	for i := range md.filters {
+		if flusher, ok := md.filters[i].(Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// Time that Stop waits for pending windows to be sent
+const stopFlushTimeout = time.Second
+
+// Stop model, pending windows are flushed before. Windows that can't be sent in stopFlushTimeout, because the filters
+// that receive them are stuck, are dropped.
 func (md *model) Stop() {
+	md.quitOnce.Do(func() { close(md.quit) })
+	flushed := make(chan int)
+	go func() {
+		defer close(flushed)
+		md.Flush()
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(stopFlushTimeout):
+	}
 	md.singal.Stop()
 }
 
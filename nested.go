@@ -0,0 +1,78 @@
+package arch
+
+import (
+	"reflect"
+)
+
+// Levels of slices between type t and the type of pipe elements, a receive channel is a level too but it can't
+// be nested. It's zero if the elements of t are not sent one by one through pipe.
+func depthOf(t, elem reflect.Type) int {
+	if isStream(t) {
+		if t.Elem() == elem {
+			return 1
+		}
+		return 0
+	}
+	depth := 0
+	for t != elem {
+		if t.Kind() != reflect.Slice {
+			return 0
+		}
+		t = t.Elem()
+		depth++
+	}
+	return depth
+}
+
+// Receive a slice of sliceType whose elements are sent one by one through pipe, count is the length received
+// before. Nested slices receive their own length from length pipe before their elements. It returns false if
+// a pipe was closed.
+func recvSlice(pipe, length Pipe, ftr *filter, sliceType reflect.Type, count lenItem) (reflect.Value, header, bool, error) {
+	capacity := count.count
+	if capacity == streamed {
+		capacity = 0
+	}
+	slice := reflect.MakeSlice(sliceType, 0, capacity)
+	head := header{}
+	elemType := sliceType.Elem()
+	if elemType == pipe.CheckType() {
+		zero := reflect.Zero(elemType)
+		ok, err := recvElems(pipe, ftr, count, func(it *item) {
+			head = head.merge(it.header)
+			if it.data != nil {
+				slice = reflect.Append(slice, reflect.ValueOf(it.data))
+			} else {
+				slice = reflect.Append(slice, zero)
+			}
+		})
+		return slice, head, ok, err
+	}
+	for i := 0; i < count.count; i++ {
+		done := ftr.waitFor(OpLen, length)
+		innerLen, innerSeq, ok := itemsOf(length).recvLen(pipe)
+		done()
+		if !ok {
+			return slice, head, false, nil
+		}
+		inner, innerHead, ok, err := recvSlice(pipe, length, ftr, elemType, lenItem{innerLen, innerSeq})
+		if !ok || err != nil {
+			return slice, head, ok, err
+		}
+		slice = reflect.Append(slice, inner)
+		head = head.merge(innerHead)
+	}
+	return slice, head, true, nil
+}
+
+// Send the elements of a slice one by one through pipe after its length, nested slices send their own length
+// before their elements
+func (ftr *filter) sendSlice(pipe Pipe, slice reflect.Value, depth int, head header) {
+	ftr.sendLen(pipe, slice.Len(), head.seq)
+	for i := 0; i < slice.Len(); i++ {
+		if depth > 1 {
+			ftr.sendSlice(pipe, slice.Index(i), depth-1, head)
+		} else {
+			ftr.sendItem(pipe, &item{data: slice.Index(i).Interface(), header: head})
+		}
+	}
+}
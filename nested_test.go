@@ -0,0 +1,55 @@
+package arch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Split text into lines of words
+func splitLines(text []string) [][]string {
+	lines := make([][]string, len(text))
+	for i, line := range text {
+		lines[i] = strings.Fields(line)
+	}
+	return lines
+}
+
+func TestNestedLength(t *testing.T) {
+	text := NewPipe("text", []string{}, 1)
+	words := NewPipe("words", "", 1)
+	lens := NewPipe("lens", int(0), 1)
+	table := NewPipe("table", [][]int{}, 1)
+	split := NewFilterWithPipes("split", splitLines, WithPipes(text), WithPipes(words), WithLens())
+	measure := NewFilterWithPipes("measure", func(word string) int { return len(word) }, WithPipes(words), WithPipes(lens), WithLens())
+	gather := NewFilterWithPipes("gather", func(lens [][]int) [][]int { return lens }, WithPipes(lens), WithPipes(table), WithLens(NewLen(lens, words)))
+	model := NewModel(WithFilters(split, measure, gather), WithPipes(text), WithPipes(table))
+	model.Run()
+	defer model.Stop()
+	for _, test := range []struct {
+		text  []string
+		table string
+	}{
+		{[]string{"one two", "", "three"}, "[[3 3] [] [5]]"},
+		{[]string{}, "[]"},
+		{[]string{"nested lengths work"}, "[[6 7 4]]"},
+	} {
+		if table := model.Call(WithInput(test.text))[0]; fmt.Sprint(table) != test.table {
+			t.Fatal(test.text, table)
+		}
+	}
+}
+
+func TestNestedLengthMismatch(t *testing.T) {
+	text := NewPipe("text", []string{}, 1)
+	words := NewPipe("words", "", 1)
+	count := NewPipe("count", int(0), 1)
+	split := NewFilterWithPipes("split", splitLines, WithPipes(text), WithPipes(words), WithLens())
+	flat := NewFilterWithPipes("flat", func(words []string) int { return len(words) }, WithPipes(words), WithPipes(count), WithLens(NewLen(words, words)))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a slice can't be received with the lengths of nested slices")
+		}
+	}()
+	NewModel(WithFilters(split, flat), WithPipes(text), WithPipes(count))
+}
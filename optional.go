@@ -0,0 +1,104 @@
+package arch
+
+import "reflect"
+
+// Represents a value that could be absent.
+//
+// As result of a filter function, it's linked to a pipe of type T and when it's not valid the
+// filter skips the pipe: it sends an unset item instead of a value, the filters that receive it
+// don't run their function and they skip their outputs too, so joins never wait for a skipped branch.
+//
+// As parameter of a filter function, it's linked to a pipe of type T and the filter runs its function
+// even if the pipe skipped the item, this is the way to join alternative branches.
+type Optional[T any] struct {
+	Value T
+	Valid bool
+}
+
+// Create a valid optional value
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{Value: value, Valid: true}
+}
+
+// Create an absent optional value
+func None[T any]() Optional[T] {
+	return Optional[T]{}
+}
+
+// Get value and tell if it's valid
+func (opt Optional[T]) Get() (T, bool) {
+	return opt.Value, opt.Valid
+}
+
+func (opt Optional[T]) optional() (any, bool) {
+	return opt.Value, opt.Valid
+}
+
+// Implemented by every Optional[T]
+type optionalValue interface {
+	optional() (any, bool)
+}
+
+var optionalValueType = reflect.TypeOf((*optionalValue)(nil)).Elem()
+
+// Get the type of the optional value if optType is an Optional[T]
+func optionalElem(optType reflect.Type) (reflect.Type, bool) {
+	if optType.Kind() != reflect.Struct || !optType.Implements(optionalValueType) {
+		return nil, false
+	}
+	return optType.Field(0).Type, true
+}
+
+// Make an Optional[T] value of type optType, it's valid when data isn't nil
+func makeOptional(optType reflect.Type, data any) reflect.Value {
+	opt := reflect.New(optType).Elem()
+	if data != nil {
+		opt.Field(0).Set(reflect.ValueOf(data))
+		opt.Field(1).SetBool(true)
+	}
+	return opt
+}
+
+// Route used by a router to send items to a pipe
+type Route[T any] struct {
+	pipe Pipe
+	when func(T) bool
+}
+
+// Create a route that sends items to pipe when predicate is true
+func When[T any](pipe Pipe, predicate func(T) bool) Route[T] {
+	return Route[T]{pipe: pipe, when: predicate}
+}
+
+// Create a route that sends items to pipe when no previous route matches
+func Otherwise[T any](pipe Pipe) Route[T] {
+	return Route[T]{pipe: pipe}
+}
+
+// Create a filter that sends every item received from in pipe to the pipe of the first matching route.
+// The pipes of the other routes skip the item.
+func NewRouter[T any](name string, in Pipe, routes ...Route[T]) Filter {
+	optType := reflect.TypeOf(Optional[T]{})
+	outTypes := make([]reflect.Type, len(routes))
+	outs := make([]Pipe, len(routes))
+	for i := range routes {
+		outTypes[i] = optType
+		outs[i] = routes[i].pipe
+	}
+	fnType := reflect.FuncOf([]reflect.Type{reflect.TypeOf((*T)(nil)).Elem()}, outTypes, false)
+	fn := reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		value, _ := args[0].Interface().(T)
+		results := make([]reflect.Value, len(routes))
+		matched := false
+		for i := range routes {
+			opt := None[T]()
+			if !matched && (routes[i].when == nil || routes[i].when(value)) {
+				opt = Some(value)
+				matched = true
+			}
+			results[i] = reflect.ValueOf(opt)
+		}
+		return results
+	})
+	return NewFilterWithPipes(name, fn.Interface(), WithPipes(in), outs, WithLens())
+}
@@ -0,0 +1,90 @@
+package arch
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	input := NewPipe("input", int(0), 1)
+	even := NewPipe("even", int(0), 1)
+	odd := NewPipe("odd", int(0), 1)
+	evenText := NewPipe("evenText", "", 1)
+	oddText := NewPipe("oddText", "", 1)
+	final := NewPipe("final", "", 1)
+
+	router := NewRouter("parity", input,
+		When(even, func(n int) bool { return n%2 == 0 }),
+		Otherwise[int](odd),
+	)
+	evenFilter := NewFilterWithPipes("evenText", func(n int) string {
+		return fmt.Sprint("even ", n)
+	},
+		WithPipes(even),
+		WithPipes(evenText),
+		WithLens(),
+	)
+	oddFilter := NewFilterWithPipes("oddText", func(n int) string {
+		return fmt.Sprint("odd ", n)
+	},
+		WithPipes(odd),
+		WithPipes(oddText),
+		WithLens(),
+	)
+	join := NewFilterWithPipes("join", func(even, odd Optional[string]) string {
+		if text, ok := even.Get(); ok {
+			return text
+		}
+		return odd.Value
+	},
+		WithPipes(evenText, oddText),
+		WithPipes(final),
+		WithLens(),
+	)
+	model := NewModel(WithFilters(router, evenFilter, oddFilter, join), WithPipes(input), WithPipes(final))
+	model.Run()
+	for i := 0; i < 6; i++ {
+		text := model.Call(WithInput(i))[0].(string)
+		expected := fmt.Sprint("odd ", i)
+		if i%2 == 0 {
+			expected = fmt.Sprint("even ", i)
+		}
+		if text != expected {
+			t.Fatal(text, " != ", expected)
+		}
+	}
+	model.Stop()
+}
+
+func TestOptionalOutput(t *testing.T) {
+	input := NewPipe("input", int(0), 1)
+	positive := NewPipe("positive", int(0), 1)
+	doubled := NewPipe("doubled", int(0), 1)
+
+	check := NewFilterWithPipes("check", func(n int) Optional[int] {
+		if n > 0 {
+			return Some(n)
+		}
+		return None[int]()
+	},
+		WithPipes(input),
+		WithPipes(positive),
+		WithLens(),
+	)
+	double := NewFilterWithPipes("double", func(n int) int {
+		return 2 * n
+	},
+		WithPipes(positive),
+		WithPipes(doubled),
+		WithLens(),
+	)
+	model := NewModel(WithFilters(check, double), WithPipes(input), WithPipes(doubled))
+	model.Run()
+	if out := model.Call(WithInput(-1))[0]; out != nil {
+		t.Fatal(out)
+	}
+	if out := model.Call(WithInput(3))[0]; out != 6 {
+		t.Fatal(out)
+	}
+	model.Stop()
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // It's produced when data send to pipe doesn't match with pipe data type in its definition
@@ -30,28 +32,116 @@ type Pipe interface {
 	Close()                  //Close pipe internal channels, filters associated with pipe will be stopped
 }
 
+// Pipe that sends and receives items with their metadata, every pipe created by this package implements it
+type itemPipe interface {
+	Pipe
+	send(it *item)                                                                                //Send an item with its metadata
+	recv(filter Filter) *item                                                                     //Receive an item with its metadata
+	recvWithin(filter Filter, stop chan int, timeout time.Duration) (*item, bool)                 //Receive an item unless filter is stopped or it doesn't arrive in timeout
+	sendLen(len int, seq uint64)                                                                  //Send length of the elements of a call
+	recvLen(pipe Pipe) (int, uint64, bool)                                                        //Receive length with the call of its elements and tell if pipe is open
+	recvPriority(filter Filter) *item                                                             //Receive the waiting item with the highest priority
+	recvCall(filter Filter, seq uint64) *item                                                     //Receive the item of a call, items of other calls keep waiting
+	recvCallWithin(filter Filter, seq uint64, stop chan int, timeout time.Duration) (*item, bool) //Receive the item of a call unless filter is stopped or it doesn't arrive in timeout
+	unrecv(filter Filter, it *item)                                                               //Keep an item of a later call to be received again
+	channel(filter Filter) chan *item                                                             //Channel of items for filter
+	stats() PipeStats                                                                             //Runtime statistics of pipe
+	setHooks(hooks *Hooks)                                                                        //Set hooks for items sent with Set and received with Get
+}
+
+// Item plumbing of pipe, pipes linked to filters and models must be created by this package
+func itemsOf(pipe Pipe) itemPipe {
+	ip, ok := pipe.(itemPipe)
+	if !ok {
+		panic(fmt.Errorf("pipe '%s' must be created with NewPipe or another pipe constructor of this package", pipe.Name()))
+	}
+	return ip
+}
+
+// Envelope for data sent through pipes
+type item struct {
+	data any
+	end  bool   //Last item of streamed elements, it has no data
+	from Filter //Filter that sent the item, nil if it was sent with Set
+	header
+}
+
+// Information that travels with data through pipes
+type header struct {
+	meta     Metadata
+	seq      uint64 //Sequence of the model call or source iteration that produced the item, zero if it's unknown
+	ticket   uint64 //Order of the item in the last balanced pipe, zero if it's unknown
+	key      string //Key set by the last partitioned pipe
+	priority int    //Priority of the call that produced the item, items with higher priority are received first
+}
+
+// Merge two headers, values of head are kept on conflict except priority that keeps the highest
+func (head header) merge(other header) header {
+	head.meta = mergeMeta(head.meta, other.meta)
+	if head.seq == 0 {
+		head.seq = other.seq
+	}
+	if head.ticket == 0 {
+		head.ticket = other.ticket
+	}
+	if head.key == "" {
+		head.key = other.key
+	}
+	if other.priority > head.priority {
+		head.priority = other.priority
+	}
+	return head
+}
+
+// Merge headers in order, values of first headers are kept on conflict
+func mergeHeaders(heads []header) header {
+	merged := header{}
+	for i := range heads {
+		merged = merged.merge(heads[i])
+	}
+	return merged
+}
+
+// Length of the elements of a slice sent one by one
+type lenItem struct {
+	count int
+	seq   uint64 //Call of the elements, zero if it's unknown
+}
+
 // pipe implementation
 type pipe struct {
 	name      string
-	conn      map[Filter]chan any //pipe data channel
-	len       map[Pipe]chan int   //pipe length channel
+	conn      map[Filter]chan *item //pipe data channel
+	len       map[Pipe]chan lenItem //pipe length channel
+	kept      map[Filter]*item      //items of later calls received while filter waited elements of a call
+	queued    map[Filter][]*item    //items taken from the channel of filter to be received by priority or by call
 	buffer    int
 	checkType reflect.Type
 	isOpen    bool
 	mtx       sync.Mutex
+	mtxClose  sync.Mutex
+	mtxKept   sync.Mutex
+	counters  pipeStats
+	hooks     atomic.Pointer[Hooks] //Hooks of the model for items sent with Set and received with Get
 }
 
 // Create a new pipe with checkType and buffer size
 func NewPipe(name string, checkType any, buffer int) Pipe {
+	return newPipe(name, checkType, buffer)
+}
+
+func newPipe(name string, checkType any, buffer int) *pipe {
 	pipeType := reflect.TypeOf(checkType)
 	if pipeType.Kind() == reflect.Ptr && pipeType.Elem().Kind() == reflect.Interface {
 		pipeType = pipeType.Elem()
 	}
 	return &pipe{
 		name:      name,
-		checkType: pipeType,                      //set check type
-		conn:      make(map[Filter]chan any, 10), //set pipe buffer
-		len:       make(map[Pipe]chan int, 10),   //set length of wrapped
+		checkType: pipeType,                        //set check type
+		conn:      make(map[Filter]chan *item, 10), //set pipe buffer
+		len:       make(map[Pipe]chan lenItem, 10), //set length of wrapped
+		kept:      make(map[Filter]*item),
+		queued:    make(map[Filter][]*item),
 		buffer:    buffer,
 		isOpen:    true,
 	}
@@ -66,7 +156,7 @@ func (pipe *pipe) To(filter Filter) error {
 	if _, ok := pipe.conn[filter]; ok {
 		return ErrFilterRegistered
 	}
-	pipe.conn[filter] = make(chan any, pipe.buffer)
+	pipe.conn[filter] = make(chan *item, pipe.buffer)
 	return nil
 }
 
@@ -75,43 +165,122 @@ func (pipe *pipe) LenTo(p Pipe) error {
 	if _, ok := pipe.len[p]; ok {
 		return ErrFilterRegistered
 	}
-	pipe.len[p] = make(chan int, pipe.buffer)
+	pipe.len[p] = make(chan lenItem, pipe.buffer)
 	return nil
 }
 
 // Send data through pipe
 func (pipe *pipe) Set(data any) {
+	it := &item{data: data}
+	pipe.send(it)
+	itemOut(&pipe.hooks, "", pipe, it)
+}
+
+// Send item through pipe
+func (pipe *pipe) send(it *item) {
 	pipe.mtx.Lock()
 	defer pipe.mtx.Unlock()
-	//Get input data data type
-	inType := reflect.TypeOf(data)
-	//Check input data type
-	if inType != nil && !inType.AssignableTo(pipe.checkType) {
-		panic(fmt.Errorf("pipe '%s' receive type '%s' but is defined as '%s'", pipe.name, inType, pipe.checkType))
-	}
+	pipe.check(it.data)
+	start := time.Now()
+	blocked := atomic.Bool{}
 	//Make sure every channel is receiving data without lost it
 	wg := sync.WaitGroup{}
 	for _, ch := range pipe.conn {
 		wg.Add(1)
-		go func(ch chan any) {
-			ch <- data
+		go func(ch chan *item) {
+			if deliver(ch, it) {
+				blocked.Store(true)
+			}
 			wg.Done()
 		}(ch)
 	}
 	wg.Wait()
+	pipe.counters.sending(start, blocked.Load())
+}
+
+// Check data type, it makes panic if data is not assignable to pipe type
+func (pipe *pipe) check(data any) {
+	//Get input data data type
+	inType := reflect.TypeOf(data)
+	//Check input data type
+	if inType != nil && !inType.AssignableTo(pipe.checkType) {
+		panic(fmt.Errorf("pipe '%s' receive type '%s' but is defined as '%s'", pipe.name, inType, pipe.checkType))
+	}
 }
 
 // Get data from pipe
 func (pipe *pipe) Get(filter Filter) any {
+	it := pipe.recv(filter)
+	if filter != nil {
+		baseOf(filter).arrived(pipe, it)
+	} else {
+		itemIn(&pipe.hooks, "", pipe, it)
+	}
+	if it != nil {
+		return it.data
+	}
+	return nil
+}
+
+// Get item from pipe, it returns nil if pipe is closed
+func (pipe *pipe) recv(filter Filter) *item {
+	it, _ := pipe.recvWithin(filter, nil, 0)
+	return it
+}
+
+// Get item from pipe like recv, it returns false if stop is closed or the item doesn't arrive in timeout. Zero
+// timeout waits until the item arrives.
+func (pipe *pipe) recvWithin(filter Filter, stop chan int, timeout time.Duration) (*item, bool) {
+	pipe.mtxKept.Lock()
+	it, ok := pipe.kept[filter]
+	delete(pipe.kept, filter)
+	if queued := pipe.queued[filter]; !ok && len(queued) > 0 {
+		it, ok = queued[0], true
+		pipe.queued[filter] = queued[1:]
+	}
+	pipe.mtxKept.Unlock()
+	if ok {
+		return it, true
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case it := <-pipe.channel(filter): //take item from channel
+		return it, true
+	case <-stop:
+		return nil, false
+	case <-expired:
+		return nil, false
+	}
+}
+
+// Keep item to be received again by filter, it's the first item of a later call
+func (pipe *pipe) unrecv(filter Filter, it *item) {
+	pipe.mtxKept.Lock()
+	defer pipe.mtxKept.Unlock()
+	pipe.kept[filter] = it
+}
+
+// Get channel of items for filter
+func (pipe *pipe) channel(filter Filter) chan *item {
 	ch, ok := pipe.conn[filter]
 	if !ok {
 		panic(ErrUnRegisteredFilter)
 	}
-	return <-ch //take data from channel
+	return ch
 }
 
 // Send data through pipe
 func (pipe *pipe) SetLen(length int) {
+	pipe.sendLen(length, 0)
+}
+
+// Send length of the elements of a call through pipe
+func (pipe *pipe) sendLen(length int, seq uint64) {
 	pipe.mtx.Lock()
 	defer pipe.mtx.Unlock()
 	//Get input data data type
@@ -119,8 +288,8 @@ func (pipe *pipe) SetLen(length int) {
 	wg := sync.WaitGroup{}
 	for _, ch := range pipe.len {
 		wg.Add(1)
-		go func(ch chan int) {
-			ch <- length
+		go func(ch chan lenItem) {
+			ch <- lenItem{count: length, seq: seq}
 			wg.Done()
 		}(ch)
 	}
@@ -129,11 +298,19 @@ func (pipe *pipe) SetLen(length int) {
 
 // Get data from pipe
 func (pipe *pipe) Len(p Pipe) int {
+	length, _, _ := pipe.recvLen(p)
+	return length
+}
+
+// Get length for pipe with the call of its elements and tell if pipe is open, items sent before closing are
+// received first
+func (pipe *pipe) recvLen(p Pipe) (int, uint64, bool) {
 	ch, ok := pipe.len[p]
 	if !ok {
 		panic(ErrUnRegisteredFilter)
 	}
-	return <-ch //take data from channel
+	length, ok := <-ch //take data from channel
+	return length.count, length.seq, ok
 }
 
 // Get pipe internal checkType
@@ -142,14 +319,21 @@ func (pipe *pipe) CheckType() reflect.Type {
 }
 
 func (pipe *pipe) IsOpen() bool {
+	pipe.mtxClose.Lock()
+	defer pipe.mtxClose.Unlock()
 	return pipe.isOpen
 }
 
 func (pipe *pipe) Close() {
+	pipe.mtxClose.Lock()
+	defer pipe.mtxClose.Unlock()
 	if pipe.isOpen {
 		for _, ch := range pipe.conn {
 			close(ch)
 		}
+		for _, ch := range pipe.len {
+			close(ch)
+		}
 		pipe.isOpen = false
 	}
 }
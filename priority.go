@@ -0,0 +1,248 @@
+package arch
+
+import (
+	"time"
+)
+
+// Set the priority of every item sent by the call, items of calls with higher priority overtake items of calls with
+// lower priority waiting at the inputs of every filter. The default priority is zero.
+func WithPriority(level int) CallOption {
+	return func(opts *callOptions) {
+		opts.priority = level
+	}
+}
+
+// Get the waiting item with the highest priority, items with the same priority are received in arrival order. Items
+// are taken from the channel up to the buffer size to compare them. It returns nil if pipe is closed and there are
+// no waiting items.
+func (pipe *pipe) recvPriority(filter Filter) *item {
+	ch := pipe.channel(filter)
+	pipe.mtxKept.Lock()
+	queued := pipe.requeue(filter)
+	limit := pipe.buffer
+	if limit < 1 {
+		limit = 1
+	}
+take:
+	for len(queued) < limit {
+		select {
+		case it, ok := <-ch:
+			if !ok {
+				break take
+			}
+			queued = append(queued, it)
+		default:
+			break take
+		}
+	}
+	if len(queued) == 0 {
+		pipe.mtxKept.Unlock()
+		return <-ch
+	}
+	first := 0
+	for i := range queued {
+		if queued[i].priority > queued[first].priority {
+			first = i
+		}
+	}
+	it := queued[first]
+	pipe.queued[filter] = append(queued[:first], queued[first+1:]...)
+	pipe.mtxKept.Unlock()
+	return it
+}
+
+// Get the item of the call seq, items of other calls keep waiting in arrival order. Items of unknown calls are
+// received as they arrive. It returns nil if pipe is closed before the item arrives.
+func (pipe *pipe) recvCall(filter Filter, seq uint64) *item {
+	it, _ := pipe.recvCallWithin(filter, seq, nil, 0)
+	return it
+}
+
+// Get the item of the call seq like recvCall, it returns false if stop is closed or the item doesn't arrive in
+// timeout. Zero timeout waits until the item arrives.
+func (pipe *pipe) recvCallWithin(filter Filter, seq uint64, stop chan int, timeout time.Duration) (*item, bool) {
+	if seq == 0 {
+		return pipe.recvWithin(filter, stop, timeout)
+	}
+	ch := pipe.channel(filter)
+	pipe.mtxKept.Lock()
+	queued := pipe.requeue(filter)
+	for i, it := range queued {
+		if it.seq == seq {
+			pipe.queued[filter] = append(queued[:i], queued[i+1:]...)
+			pipe.mtxKept.Unlock()
+			return it, true
+		}
+	}
+	pipe.mtxKept.Unlock()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case it := <-ch:
+			if it == nil || it.seq == seq || it.seq == 0 {
+				return it, true
+			}
+			pipe.mtxKept.Lock()
+			pipe.queued[filter] = append(pipe.queued[filter], it)
+			pipe.mtxKept.Unlock()
+		case <-stop:
+			return nil, false
+		case <-expired:
+			return nil, false
+		}
+	}
+}
+
+// Items of filter taken from the channel, the item kept while filter waited elements of a call is the first one. It
+// must be called with the kept lock.
+func (pipe *pipe) requeue(filter Filter) []*item {
+	if it, ok := pipe.kept[filter]; ok {
+		delete(pipe.kept, filter)
+		pipe.queued[filter] = append([]*item{it}, pipe.queued[filter]...)
+	}
+	return pipe.queued[filter]
+}
+
+// Pipes whose items carry the seq of the call that produced them: model inputs and outputs of filters whose inputs
+// carry it. Sources, windows and joins send items of their own or of several calls, so the items of a pipe that
+// they feed, directly or through other filters, are received in arrival order by the followers of a leader input.
+func (md *model) byCall() map[Pipe]bool {
+	producers := make(map[Pipe][]Filter)
+	for _, f := range md.filters {
+		baseOf(f).output.ForEach(func(pipe Pipe) bool {
+			producers[pipe] = append(producers[pipe], f)
+			return true
+		})
+	}
+	byCall := make(map[Pipe]bool)
+	for _, pipe := range md.inputs {
+		byCall[pipe] = true
+	}
+	var carries func(pipe Pipe) bool
+	carries = func(pipe Pipe) bool {
+		if known, ok := byCall[pipe]; ok {
+			return known
+		}
+		byCall[pipe] = false //pipes of a cycle don't carry calls
+		known := len(producers[pipe]) > 0
+		for _, f := range producers[pipe] {
+			switch f.(type) {
+			case *window, *keyedJoin:
+				known = false
+			}
+			ftr := baseOf(f)
+			if ftr.IsSource() {
+				known = false
+			}
+			ftr.input.ForEach(func(in Pipe) bool {
+				known = known && carries(in)
+				return known
+			})
+		}
+		byCall[pipe] = known
+		return known
+	}
+	for _, f := range md.filters {
+		baseOf(f).input.ForEach(func(pipe Pipe) bool {
+			carries(pipe)
+			return true
+		})
+	}
+	return byCall
+}
+
+// Input that decides the call received by a filter when the model is called with priorities: the first input with
+// length, whose slices are received in arrival order, or else the first input. Other inputs follow its call.
+func (ftr *filter) leader() Pipe {
+	var leader Pipe
+	ftr.input.ForEach(func(pipe Pipe) bool {
+		switch {
+		case leader == nil:
+			leader = pipe
+		case (ftr.length[pipe] != nil) != (ftr.length[leader] != nil):
+			if ftr.length[pipe] != nil {
+				leader = pipe
+			}
+		case ftr.inLink[pipe] < ftr.inLink[leader]:
+			leader = pipe
+		}
+		return true
+	})
+	return leader
+}
+
+// Call received by the leader input of a filter, it's nil when the model wasn't called with priorities
+type lead struct {
+	seq    uint64
+	closed bool
+	ready  chan int
+}
+
+// Start the call of the next invocation of filter if the model was called with priorities
+func (ftr *filter) follow() *lead {
+	if ftr.prioritized == nil || !ftr.prioritized.Load() {
+		return nil
+	}
+	return &lead{ready: make(chan int)}
+}
+
+// Set the call received by the leader input, closed tells if the input was closed
+func (ld *lead) set(seq uint64, closed bool) {
+	if ld != nil {
+		ld.seq, ld.closed = seq, closed
+		close(ld.ready)
+	}
+}
+
+// Call waiting for its outputs
+type pending struct {
+	seq    uint64
+	ch     chan []any
+	output []any
+	got    []bool
+	count  int
+}
+
+// Set the output index of the call of it. When the model is called with priorities outputs are correlated with their
+// calls by sequence, otherwise and for items of unknown calls they are set to the oldest call without that output.
+// It must be called with the calls lock.
+func (md *model) deliver(index int, it *item) {
+	var call *pending
+	for _, c := range md.calls {
+		if c.got[index] {
+			continue
+		}
+		if call == nil {
+			call = c
+		}
+		if it != nil && it.seq != 0 && c.seq == it.seq && md.prioritized.Load() {
+			call = c
+			break
+		}
+	}
+	if call != nil {
+		if it != nil {
+			call.output[index] = it.data
+		}
+		call.got[index] = true
+		call.count++
+	}
+}
+
+// Send calls with every output to their callers, it must be called with the calls lock
+func (md *model) complete() {
+	calls := md.calls[:0]
+	for _, c := range md.calls {
+		if c.count == len(c.output) {
+			c.ch <- c.output
+		} else {
+			calls = append(calls, c)
+		}
+	}
+	md.calls = calls
+}
@@ -0,0 +1,166 @@
+package arch
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityOvertakes(t *testing.T) {
+	in := NewPipe("in", int(0), 20)
+	out := NewPipe("out", int(0), 20)
+	started := make(chan int)
+	gate := make(chan int)
+	slow := NewFilterWithPipes("slow", func(n int) int {
+		if n == 0 {
+			close(started)
+			<-gate
+		}
+		time.Sleep(time.Millisecond)
+		return n * 10
+	}, WithPipes(in), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(slow), WithPipes(in), WithPipes(out))
+	model.Run()
+	defer model.Stop()
+	mtx := sync.Mutex{}
+	order := make([]int, 0, 11)
+	wg := sync.WaitGroup{}
+	call := func(n int, opts ...CallOption) {
+		defer wg.Done()
+		output := model.Call(WithInput(n), opts...)
+		if output[0] != n*10 {
+			t.Error("output of call", n, "is", output)
+		}
+		mtx.Lock()
+		order = append(order, n)
+		mtx.Unlock()
+	}
+	//The first call blocks the filter while the others wait at its input
+	wg.Add(1)
+	go call(0)
+	<-started
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go call(i)
+	}
+	time.Sleep(time.Millisecond * 20)
+	wg.Add(1)
+	go call(100, WithPriority(1))
+	time.Sleep(time.Millisecond * 20)
+	close(gate)
+	wg.Wait()
+	if order[0] != 0 || order[1] != 100 {
+		t.Fatal("high priority call must overtake waiting calls", order)
+	}
+}
+
+func TestPriorityFollowsCall(t *testing.T) {
+	in := NewPipe("in", int(0), 20)
+	double := NewPipe("double", int(0), 20)
+	triple := NewPipe("triple", int(0), 20)
+	out := NewPipe("out", int(0), 20)
+	first := NewFilterWithPipes("double", func(n int) int {
+		time.Sleep(time.Millisecond)
+		return n * 2
+	}, WithPipes(in), WithPipes(double), WithLens())
+	second := NewFilterWithPipes("triple", func(n int) int {
+		time.Sleep(time.Millisecond * 3)
+		return n * 3
+	}, WithPipes(in), WithPipes(triple), WithLens())
+	sum := NewFilterWithPipes("sum", func(a, b int) int {
+		return a + b
+	}, WithPipes(double, triple), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(first, second, sum), WithPipes(in), WithPipes(out))
+	model.Run()
+	defer model.Stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if output := model.Call(WithInput(i), WithPriority(i%3)); output[0] != i*5 {
+				t.Error("inputs of different calls were joined", i, output)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPriorityFollowerArrival(t *testing.T) {
+	nums := NewPipe("nums", int(0), 1)
+	windows := NewPipe("windows", int(0), 3)
+	totals := NewPipe("totals", int(0), 1)
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	count := 0
+	source := NewSourceFilter("counter", func() (int, bool) {
+		count++
+		return count, true
+	}, WithPipes(nums))
+	window := NewCountWindow("window", nums, windows, 3)
+	sum := NewFilterWithPipes("sum", func(ns []int) int {
+		total := 0
+		for _, n := range ns {
+			total += n
+		}
+		return total
+	}, WithPipes(windows), WithPipes(totals), WithLens(NewLen(windows, windows)))
+	add := NewFilterWithPipes("add", func(n, total int) int {
+		return n + total
+	}, WithPipes(in, totals), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(source, window, sum, add), WithPipes(in), WithPipes(out))
+	model.Run()
+	defer model.Stop()
+	//Totals of windows don't carry the seq of the call, so they are received in arrival order
+	done := make(chan []any)
+	go func() {
+		done <- append(model.Call(WithInput(100), WithPriority(1)), model.Call(WithInput(200))...)
+	}()
+	select {
+	case output := <-done:
+		if output[0] != 106 || output[1] != 215 {
+			t.Fatal(output)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("follower input fed by a window waits for the call of the leader input")
+	}
+}
+
+func TestPriorityScatterGather(t *testing.T) {
+	in := NewPipe("in", int(0), 10)
+	elems := NewPipe("elems", int(0), 10)
+	squared := NewPipe("squared", int(0), 10)
+	out := NewPipe("out", int(0), 10)
+	split := NewFilterWithPipes("split", func(n int) []int {
+		return []int{n, n, n}
+	}, WithPipes(in), WithPipes(elems), WithLens())
+	//Elements of calls with higher priority overtake the others, so they reach gather interleaved
+	square := NewFilterWithPipes("square", func(n int) int {
+		time.Sleep(time.Millisecond)
+		return n * n
+	}, WithPipes(elems), WithPipes(squared), WithLens())
+	gather := NewFilterWithPipes("gather", func(squared []int) int {
+		total := 0
+		for _, n := range squared {
+			total += n
+		}
+		return total
+	}, WithPipes(squared), WithPipes(out), WithLens(NewLen(squared, elems)))
+	model := NewModel(WithFilters(split, square, gather), WithPipes(in), WithPipes(out))
+	model.Run()
+	defer model.Stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if output := model.Call(WithInput(i), WithPriority(i%3)); output[0] != 3*i*i {
+				t.Error("output of call", i, "is", output)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if errs := baseOf(gather).errs; len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
@@ -1,25 +1,33 @@
 package arch
 
+import "sync"
+
 type queue struct {
-	parallel        int
-	inputs          []any
-	outputs         []chan any
-	lock, prll, sgn chan int
+	parallel  int
+	inputs    []any
+	outputs   []chan any
+	lock, sgn chan int
+	workers   *limiter
 }
 
 func newQueue(parallel int) *queue {
+	return newLimitedQueue(parallel, newLimiter(parallel))
+}
+
+// Create a queue whose items processed at the same time are limited by workers, parallel is the maximum limit
+func newLimitedQueue(parallel int, workers *limiter) *queue {
 	return &queue{
 		parallel: parallel,
 		inputs:   make([]any, 0, parallel),
 		outputs:  make([]chan any, 0, parallel),
 		lock:     make(chan int, 1),
-		prll:     make(chan int, parallel),
 		sgn:      make(chan int, 1),
+		workers:  workers,
 	}
 }
 
 func (q *queue) push(item any) chan any {
-	q.prll <- 0
+	q.workers.acquire()
 	q.lock <- 0
 	q.inputs = append(q.inputs, item)
 	output := make(chan any, 1)
@@ -29,7 +37,7 @@ func (q *queue) push(item any) chan any {
 }
 
 func (q *queue) set() {
-	<-q.prll
+	q.workers.release()
 }
 
 func (q *queue) exit() {
@@ -68,3 +76,50 @@ func (q *queue) run(fn func(output any)) {
 		}()
 	}
 }
+
+// Limits the items processed at the same time, the limit can change while items are processed
+type limiter struct {
+	mtx     sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	running int
+}
+
+func newLimiter(limit int) *limiter {
+	lm := &limiter{limit: limit}
+	lm.cond = sync.NewCond(&lm.mtx)
+	return lm
+}
+
+// Wait until an item can be processed
+func (lm *limiter) acquire() {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	for lm.running >= lm.limit {
+		lm.cond.Wait()
+	}
+	lm.running++
+}
+
+// An item was processed
+func (lm *limiter) release() {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	lm.running--
+	lm.cond.Broadcast()
+}
+
+// Change the limit, items being processed over a lower limit are not interrupted
+func (lm *limiter) resize(limit int) {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	lm.limit = limit
+	lm.cond.Broadcast()
+}
+
+// Current limit
+func (lm *limiter) size() int {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	return lm.limit
+}
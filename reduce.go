@@ -0,0 +1,165 @@
+package arch
+
+import (
+	"reflect"
+	"time"
+)
+
+// Numeric types that can be added
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Types that can be compared with < and >
+type Ordered interface {
+	Number | ~string
+}
+
+// Represents how items of type T are folded into an accumulator of type A
+type Fold[T, A any] struct {
+	Init func() A              //Initial accumulator
+	Step func(acc A, item T) A //Fold an item into the accumulator
+}
+
+// Fold that counts items
+func Count[T any]() Fold[T, int] {
+	return Fold[T, int]{
+		Init: func() int { return 0 },
+		Step: func(acc int, item T) int { return acc + 1 },
+	}
+}
+
+// Fold that adds items
+func Sum[T Number]() Fold[T, T] {
+	return Fold[T, T]{
+		Init: func() T { return 0 },
+		Step: func(acc T, item T) T { return acc + item },
+	}
+}
+
+// Fold that keeps the minimum item, it's absent if there are no items
+func Min[T Ordered]() Fold[T, Optional[T]] {
+	return Fold[T, Optional[T]]{
+		Init: None[T],
+		Step: func(acc Optional[T], item T) Optional[T] {
+			if !acc.Valid || item < acc.Value {
+				return Some(item)
+			}
+			return acc
+		},
+	}
+}
+
+// Fold that keeps the maximum item, it's absent if there are no items
+func Max[T Ordered]() Fold[T, Optional[T]] {
+	return Fold[T, Optional[T]]{
+		Init: None[T],
+		Step: func(acc Optional[T], item T) Optional[T] {
+			if !acc.Valid || item > acc.Value {
+				return Some(item)
+			}
+			return acc
+		},
+	}
+}
+
+// Fold without types used by reducers
+type folder struct {
+	accType reflect.Type
+	init    func() any
+	step    func(acc, data any) any
+}
+
+func newFolder[T, A any](fold Fold[T, A]) *folder {
+	return &folder{
+		accType: reflect.TypeOf((*A)(nil)).Elem(),
+		init:    func() any { return fold.Init() },
+		step:    func(acc, data any) any { return fold.Step(acc.(A), data.(T)) },
+	}
+}
+
+// Value of accumulator, nil accumulators of interface types are zero values
+func (fold *folder) value(acc any) reflect.Value {
+	if acc == nil {
+		return reflect.Zero(fold.accType)
+	}
+	return reflect.ValueOf(acc)
+}
+
+// Represents a reducer that folds the items of a pipe using the length provided by other pipe
+type reducer struct {
+	*filter
+	in, length Pipe
+	fold       *folder
+}
+
+// Create a reducer that folds items from in pipe into an accumulator as they arrive, and sends it through out pipe
+// when the count of items provided by length pipe is reached. It's like a filter with a slice parameter linked
+// with NewLen(in, length), but the items are never held in memory.
+func NewReducer[T, A any](name string, in, length, out Pipe, fold Fold[T, A]) Filter {
+	folder := newFolder(fold)
+	//Function is never called, it describes reducer for the model checks
+	fnType := reflect.FuncOf([]reflect.Type{reflect.SliceOf(in.CheckType())}, []reflect.Type{folder.accType}, false)
+	fn := reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.Zero(folder.accType)}
+	})
+	ftr := NewFilterWithPipes(name, fn.Interface(), WithPipes(in), WithPipes(out), WithLens(NewLen(in, length)))
+	return &reducer{
+		filter: baseOf(ftr),
+		in:     in,
+		length: length,
+		fold:   folder,
+	}
+}
+
+// Create a reducer that folds items from in pipe and sends the accumulator through out pipe every duration,
+// when the input pipe is closed, when the model stops or when Flush is called. With a duration lesser than or
+// equal to zero it only sends the accumulator on flush.
+func NewTimeReducer[T, A any](name string, in, out Pipe, every time.Duration, fold Fold[T, A]) Filter {
+	return newWindow(name, in, out, 0, 0, every, newFolder(fold))
+}
+
+// Run reducer
+func (red *reducer) Run() {
+	ftr := red.filter
+	if !ftr.compiled {
+		panic(ErrFilterNotCompiled)
+	}
+	ftr.started()
+	defer ftr.stopped()
+	defer ftr.closeInputs()
+	defer ftr.output.Close()
+	for ftr.output.IsOpen() {
+		if ftr.sg != nil && ftr.sg.tryStop() {
+			return
+		}
+		done := ftr.waitFor(OpLen, red.length)
+		count, seq, ok := itemsOf(red.length).recvLen(red.in)
+		done()
+		if !ok {
+			return
+		}
+		acc := red.fold.init()
+		head := header{}
+		ok, err := recvElems(red.in, ftr, lenItem{count: count, seq: seq}, func(it *item) {
+			head = head.merge(it.header)
+			if it.data != nil {
+				ftr.share.acquire()
+				start := ftr.counters.begin()
+				acc = red.fold.step(acc, it.data)
+				ftr.counters.end(start)
+				ftr.share.release()
+			}
+		})
+		if !ok {
+			return
+		}
+		if err != nil {
+			ftr.fail(err)
+		}
+		head.ticket = 0 //reducers join items of several tickets
+		ftr.send([]reflect.Value{red.fold.value(acc)}, head, err, false)
+	}
+}
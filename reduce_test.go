@@ -0,0 +1,73 @@
+package arch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run a model that splits text into words and reduces the lengths of words
+func runReducer[A any](t *testing.T, fold Fold[int, A], texts ...string) []string {
+	text := NewPipe("text", "", 1)
+	words := NewPipe("words", "", 1)
+	lens := NewPipe("lens", int(0), 1)
+	var zero A
+	reduced := NewPipe("reduced", zero, 1)
+	split := NewFilterWithPipes("split", strings.Fields, WithPipes(text), WithPipes(words), WithLens())
+	measure := NewFilterWithPipes("measure", func(word string) int { return len(word) }, WithPipes(words), WithPipes(lens), WithLens())
+	reducer := NewReducer("reduce", lens, words, reduced, fold)
+	model := NewModel(WithFilters(split, measure, reducer), WithPipes(text), WithPipes(reduced))
+	model.Run()
+	defer model.Stop()
+	results := make([]string, len(texts))
+	for i, text := range texts {
+		results[i] = fmt.Sprint(model.Call(WithInput(text))[0])
+	}
+	return results
+}
+
+func TestReducer(t *testing.T) {
+	texts := []string{"one two three", "", "reducers"}
+	if sums := runReducer(t, Sum[int](), texts...); fmt.Sprint(sums) != "[11 0 8]" {
+		t.Fatal(sums)
+	}
+	if counts := runReducer(t, Count[int](), texts...); fmt.Sprint(counts) != "[3 0 1]" {
+		t.Fatal(counts)
+	}
+	if longest := runReducer(t, Max[int](), texts...); fmt.Sprint(longest) != "[{5 true} {0 false} {8 true}]" {
+		t.Fatal(longest)
+	}
+	concat := Fold[int, string]{
+		Init: func() string { return "" },
+		Step: func(acc string, n int) string { return acc + fmt.Sprint(n) },
+	}
+	if custom := runReducer(t, concat, texts...); fmt.Sprint(custom) != "[335  8]" {
+		t.Fatal(custom)
+	}
+}
+
+func TestTimeReducerFlush(t *testing.T) {
+	input := NewPipe("input", "", 1)
+	counts := NewPipe("counts", int(0), 1)
+	count := NewTimeReducer("count", input, counts, 0, Count[string]())
+	received := make(chan int, 1)
+	sink := NewSinkFilter("collect", func(count int) {
+		received <- count
+	}, WithPipes(counts), WithLens())
+	model := NewModel(WithFilters(count, sink), WithPipes(input), WithPipes())
+	model.Run()
+	for _, word := range []string{"a", "b", "c"} {
+		model.Call(WithInput(word))
+	}
+	model.Flush()
+	select {
+	case n := <-received:
+		if n != 3 {
+			t.Fatal(n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("accumulator was not flushed")
+	}
+	model.Stop()
+}
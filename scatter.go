@@ -0,0 +1,30 @@
+package arch
+
+import (
+	"reflect"
+)
+
+// Create the filters of a scatter/gather without declaring length pipes.
+//
+// Split receives items from in pipe and its slice is sent element by element through a pipe of items, perItem
+// creates the filters that process items one by one and send one result for every item through a pipe of
+// results, then gather receives the results of every item in a slice and sends its result through out pipe.
+// The pipe of items is used as length of the pipe of results, so NewModel checks the filters of perItem like
+// any other filters that process elements one by one.
+func ScatterGather[In, T, U, Out any](name string, in, out Pipe, split func(In) []T, perItem func(items, results Pipe) []Filter, gather func([]U) Out) []Filter {
+	items := NewPipe(name+".items", sampleOf[T](), 1)
+	results := NewPipe(name+".results", sampleOf[U](), 1)
+	filters := []Filter{NewFilterWithPipes(name+".split", split, WithPipes(in), WithPipes(items), WithLens())}
+	filters = append(filters, perItem(items, results)...)
+	filters = append(filters, NewFilterWithPipes(name+".gather", gather, WithPipes(results), WithPipes(out), WithLens(NewLen(results, items))))
+	return filters
+}
+
+// Value used to create a pipe of type T, pipes of interface types are created with a pointer to the interface
+func sampleOf[T any]() any {
+	if reflect.TypeOf((*T)(nil)).Elem().Kind() == reflect.Interface {
+		return (*T)(nil)
+	}
+	var sample T
+	return sample
+}
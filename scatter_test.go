@@ -0,0 +1,58 @@
+package arch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScatterGather(t *testing.T) {
+	text := NewPipe("text", "", 1)
+	total := NewPipe("total", int(0), 1)
+	filters := ScatterGather("count", text, total, strings.Fields,
+		func(words, lens Pipe) []Filter {
+			upper := NewPipe("upper", "", 1)
+			return WithFilters(
+				NewFilterWithPipes("upper", strings.ToUpper, WithPipes(words), WithPipes(upper), WithLens()),
+				NewFilterWithPipes("len", func(word string) int { return len(word) }, WithPipes(upper), WithPipes(lens), WithLens()),
+			)
+		},
+		func(lens []int) int {
+			total := 0
+			for _, n := range lens {
+				total += n
+			}
+			return total
+		},
+	)
+	model := NewModel(filters, WithPipes(text), WithPipes(total))
+	model.Run()
+	defer model.Stop()
+	results := []any{}
+	for _, input := range []string{"scatter and gather", "", "pipes"} {
+		results = append(results, model.Call(WithInput(input))...)
+	}
+	if fmt.Sprint(results) != "[16 0 5]" {
+		t.Fatal(results)
+	}
+}
+
+func TestScatterGatherDeadlock(t *testing.T) {
+	text := NewPipe("text", "", 1)
+	total := NewPipe("total", int(0), 1)
+	filters := ScatterGather("count", text, total, strings.Fields,
+		func(words, letters Pipe) []Filter {
+			//Sending every letter of a word one by one doesn't send one result for every word
+			return WithFilters(NewFilterWithPipes("letters", func(word string) []string {
+				return strings.Split(word, "")
+			}, WithPipes(words), WithPipes(letters), WithLens()))
+		},
+		func(letters []string) int { return len(letters) },
+	)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("per item filters must send one result for every item")
+		}
+	}()
+	NewModel(filters, WithPipes(text), WithPipes(total))
+}
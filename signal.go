@@ -1,47 +1,67 @@
 package arch
 
-import "time"
+import (
+	"context"
+	"sync"
+)
 
 // Create a Signal
 func NewSignal() Signal {
-	return &signal{}
+	return newSignal()
+}
+
+func newSignal() *signal {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &signal{stop: make(chan int), done: make(chan int), ctx: ctx, cancel: cancel}
 }
 
 type signal struct {
-	count int
-	stop  chan int
+	mtx      sync.Mutex
+	count    int
+	stop     chan int //closed on stop, every filter and waiter sees it
+	done     chan int //closed when every filter is finished
+	stopOnce sync.Once
+	doneOnce sync.Once
+	ctx      context.Context //Parent of the contexts injected in filter functions, it's cancelled on stop
+	cancel   context.CancelFunc
 }
 
+// Stop every filter, it can be called several times
 func (sg *signal) Stop() {
-	for i := 0; i < sg.count; i++ {
-		sg.stop <- 0
-	}
+	sg.stopOnce.Do(func() {
+		close(sg.stop)
+		sg.cancel()
+	})
+}
+
+// Release waiters when every filter is finished
+func (sg *signal) finish() {
+	sg.doneOnce.Do(func() {
+		close(sg.done)
+	})
 }
 
-func (sg *signal) init() {
+// Count a filter controlled by signal
+func (sg *signal) add() {
+	sg.mtx.Lock()
+	defer sg.mtx.Unlock()
 	sg.count++
-	sg.stop = make(chan int, sg.count)
 }
 
 func (sg *signal) Wait() {
-	if sg.count == 0 {
+	sg.mtx.Lock()
+	count := sg.count
+	sg.mtx.Unlock()
+	if count == 0 {
 		return
 	}
-	sg.init()
-	for {
-		select {
-		case <-sg.stop:
-			return
-		default:
-			time.Sleep(time.Millisecond)
-		}
+	select {
+	case <-sg.stop:
+	case <-sg.done:
 	}
 }
 
 func (sg *signal) tryStop() bool {
-	if sg.stop == nil {
-		return true
-	}
 	select {
 	case <-sg.stop:
 		return true
@@ -0,0 +1,62 @@
+//go:build go1.21
+
+// Package sloghooks logs the lifecycle, the items, the errors and the stalls of the filters of a model with log/slog.
+package sloghooks
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	arch "github.com/stellviaproject/pipfil-arch"
+)
+
+// Levels of the records of every hook
+type Levels struct {
+	Lifecycle slog.Level //Filter start and stop
+	Items     slog.Level //Items received and sent
+	Errors    slog.Level //Errors of filters
+	Stalls    slog.Level //Filters blocked sending items
+}
+
+// Default levels, items are logged with debug level because there is a record for every item
+var DefaultLevels = Levels{
+	Lifecycle: slog.LevelInfo,
+	Items:     slog.LevelDebug,
+	Errors:    slog.LevelError,
+	Stalls:    slog.LevelWarn,
+}
+
+// Create hooks that log with logger using the default levels
+func New(logger *slog.Logger) arch.Hooks {
+	return WithLevels(logger, DefaultLevels)
+}
+
+// Create hooks that log with logger using levels
+func WithLevels(logger *slog.Logger, levels Levels) arch.Hooks {
+	ctx := context.Background()
+	item := func(msg string) func(filter, pipe string, seq uint64) {
+		return func(filter, pipe string, seq uint64) {
+			//Records are built only when the level is enabled, items are the hot path
+			if logger.Enabled(ctx, levels.Items) {
+				logger.LogAttrs(ctx, levels.Items, msg, slog.String("filter", filter), slog.String("pipe", pipe), slog.Uint64("seq", seq))
+			}
+		}
+	}
+	return arch.Hooks{
+		OnFilterStart: func(filter string) {
+			logger.LogAttrs(ctx, levels.Lifecycle, "filter started", slog.String("filter", filter))
+		},
+		OnFilterStop: func(filter string) {
+			logger.LogAttrs(ctx, levels.Lifecycle, "filter stopped", slog.String("filter", filter))
+		},
+		OnItemIn:  item("item received"),
+		OnItemOut: item("item sent"),
+		OnError: func(filter string, err error) {
+			logger.LogAttrs(ctx, levels.Errors, "filter error", slog.String("filter", filter), slog.Any("error", err))
+		},
+		OnStall: func(filter, pipe string, blocked time.Duration) {
+			logger.LogAttrs(ctx, levels.Stalls, "filter stalled", slog.String("filter", filter), slog.String("pipe", pipe), slog.Duration("blocked", blocked))
+		},
+	}
+}
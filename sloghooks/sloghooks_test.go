@@ -0,0 +1,61 @@
+//go:build go1.21
+
+package sloghooks
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	arch "github.com/stellviaproject/pipfil-arch"
+)
+
+func TestHooks(t *testing.T) {
+	nums := arch.NewPipe("nums", int(0), 1)
+	n := 0
+	source := arch.NewSourceFilter("nums", func() (int, bool) {
+		n++
+		return n - 2, n <= 2
+	}, arch.WithPipes(nums))
+	check := arch.NewSinkFilter("check", func(n int) error {
+		if n < 0 {
+			return errors.New("negative")
+		}
+		return nil
+	}, arch.WithPipes(nums), arch.WithLens())
+	buf := bytes.NewBuffer(nil)
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	model := arch.NewModel(arch.WithFilters(source, check), arch.WithPipes(), arch.WithPipes())
+	model.SetHooks(New(logger))
+	model.Run()
+	model.Wait()
+	log := buf.String()
+	for _, line := range []string{
+		`level=INFO msg="filter started" filter=check`,
+		`level=DEBUG msg="item sent" filter=nums pipe=nums seq=1`,
+		`level=DEBUG msg="item received" filter=check pipe=nums seq=1`,
+		`level=ERROR msg="filter error" filter=check error=negative`,
+		`level=INFO msg="filter stopped" filter=nums`,
+		`level=INFO msg="filter stopped" filter=check`,
+	} {
+		if !strings.Contains(log, line) {
+			t.Fatal(line, "\n", log)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+	hooks := New(logger)
+	hooks.OnItemIn("check", "in", 1)
+	if buf.Len() != 0 {
+		t.Fatal(buf.String())
+	}
+	hooks.OnStall("check", "out", 0)
+	if !strings.Contains(buf.String(), `level=WARN msg="filter stalled" filter=check pipe=out`) {
+		t.Fatal(buf.String())
+	}
+}
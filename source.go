@@ -0,0 +1,38 @@
+package arch
+
+import "time"
+
+// Create a source filter, it has no input pipes and it runs its function until it's exhausted or stopped.
+//
+// The function could be a generator like func() (T, bool), the last result of bool type not linked to a pipe
+// tells if the source has produced an item, when it's false the source stops and its output pipes are closed.
+func NewSourceFilter(name string, fn any, outs []Pipe) Filter {
+	return NewFilterWithPipes(name, fn, WithPipes(), outs, WithLens())
+}
+
+// Create a sink filter, it has no output pipes and it terminates a branch of the model.
+//
+// The function could be like func(T) error for writing items to files or metrics.
+func NewSinkFilter(name string, fn any, ins []Pipe, lens []Length) Filter {
+	return NewFilterWithPipes(name, fn, ins, WithPipes(), lens)
+}
+
+// Create a source filter that sends the current time through out pipe every interval
+func NewTicker(name string, interval time.Duration, out Pipe) Filter {
+	next := time.Time{}
+	return NewSourceFilter(name, func() time.Time {
+		now := time.Now()
+		if next.IsZero() {
+			next = now
+		}
+		next = next.Add(interval)
+		if wait := next.Sub(now); wait > 0 {
+			time.Sleep(wait)
+		}
+		tick := time.Now()
+		if tick.After(next) {
+			next = tick //it's late or the sleep took longer, don't try to catch up
+		}
+		return tick
+	}, WithPipes(out))
+}
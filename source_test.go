@@ -0,0 +1,95 @@
+package arch
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSourceSink(t *testing.T) {
+	nums := NewPipe("nums", int(0), 1)
+	doubled := NewPipe("doubled", int(0), 1)
+
+	count := 0
+	source := NewSourceFilter("counter", func() (int, bool) {
+		if count == 10 {
+			return 0, false
+		}
+		count++
+		return count, true
+	}, WithPipes(nums))
+	double := NewFilterWithPipes("double", func(n int) int {
+		return 2 * n
+	},
+		WithPipes(nums),
+		WithPipes(doubled),
+		WithLens(),
+	)
+	mtx := sync.Mutex{}
+	sum := 0
+	sink := NewSinkFilter("sum", func(n int) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		sum += n
+		return nil
+	}, WithPipes(doubled), WithLens())
+
+	if !source.IsSource() || !sink.IsSink() || double.IsSource() || double.IsSink() {
+		t.Fatal("source or sink not detected")
+	}
+	model := NewModel(WithFilters(source, double, sink), WithPipes(), WithPipes())
+	model.Run()
+	model.Wait()
+	mtx.Lock()
+	defer mtx.Unlock()
+	if sum != 110 {
+		t.Fatal(sum)
+	}
+}
+
+func TestTicker(t *testing.T) {
+	ticks := NewPipe("ticks", time.Time{}, 1)
+	ticker := NewTicker("ticker", time.Millisecond*5, ticks)
+	received := make(chan time.Time, 10)
+	sink := NewSinkFilter("received", func(tick time.Time) {
+		select {
+		case received <- tick:
+		default:
+		}
+	}, WithPipes(ticks), WithLens())
+	model := NewModel(WithFilters(ticker, sink), WithPipes(), WithPipes())
+	model.Run()
+	first := <-received
+	second := <-received
+	if second.Sub(first) < time.Millisecond*4 {
+		t.Fatal("ticks are too close")
+	}
+	model.Stop()
+}
+
+func TestModelWithoutInput(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	sink := NewSinkFilter("sink", func(int) {}, WithPipes(in), WithLens())
+	defer func() {
+		if e := recover(); e != ErrModelWithoutInput {
+			t.Fatal(e)
+		}
+	}()
+	NewModel(WithFilters(sink), WithPipes(), WithPipes())
+}
+
+func TestCompileTwice(t *testing.T) {
+	nums := NewPipe("nums", int(0), 1)
+	source := NewSourceFilter("counter", func() (int, bool, error) {
+		return 1, true, nil
+	}, WithPipes(nums))
+	for i := 0; i < 2; i++ {
+		if err := source.Compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ftr := baseOf(source)
+	if ftr.more != 1 || len(ftr.outLink) != 1 || ftr.outLink[nums] != 0 {
+		t.Fatal("second compile changed the results of the function", ftr.more, ftr.outLink)
+	}
+}
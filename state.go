@@ -0,0 +1,94 @@
+package arch
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Type of State, used to detect state parameters in filter functions
+var stateType = reflect.TypeOf((*State)(nil)).Elem()
+
+// Represents the state of a filter for the key of the item that is being processed.
+//
+// A filter function can use it declaring a parameter of type State, the key is set by a partitioned pipe,
+// items from other pipes use the empty key.
+//
+// Get followed by Put isn't atomic when the filter runs with more than one worker (see SetParallel), use Update to
+// read and write the state of the key in one step.
+type State interface {
+	Key() string                            //Key of the current item
+	Get() (any, bool)                       //Get state for the current key and tell if it's found
+	Put(value any)                          //Set state for the current key
+	Update(fn func(value any, ok bool) any) //Set state for the current key to the result of fn called with its state
+	Delete()                                //Delete state for the current key
+}
+
+// State of a filter for every key
+type stateStore struct {
+	values map[string]any
+	mtx    sync.Mutex
+}
+
+func newStateStore() *stateStore {
+	return &stateStore{values: make(map[string]any)}
+}
+
+// Copy of state of every key
+func (store *stateStore) snapshot() map[string]any {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	values := make(map[string]any, len(store.values))
+	for key, value := range store.values {
+		values[key] = value
+	}
+	return values
+}
+
+// State bound to a key
+type keyedState struct {
+	key   string
+	store *stateStore
+}
+
+func (st *keyedState) Key() string {
+	return st.key
+}
+
+func (st *keyedState) Get() (any, bool) {
+	st.store.mtx.Lock()
+	defer st.store.mtx.Unlock()
+	value, ok := st.store.values[st.key]
+	return value, ok
+}
+
+func (st *keyedState) Put(value any) {
+	st.store.mtx.Lock()
+	defer st.store.mtx.Unlock()
+	st.store.values[st.key] = value
+}
+
+func (st *keyedState) Update(fn func(value any, ok bool) any) {
+	st.store.mtx.Lock()
+	defer st.store.mtx.Unlock()
+	value, ok := st.store.values[st.key]
+	st.store.values[st.key] = fn(value, ok)
+}
+
+func (st *keyedState) Delete() {
+	st.store.mtx.Lock()
+	defer st.store.mtx.Unlock()
+	delete(st.store.values, st.key)
+}
+
+// Create a pipe that sends items with the same key always to the same filter, the key is available
+// for the filter function as the key of its State parameter.
+//
+// It's used with replicas of a filter (see NewReplicas) to hold state for every key in one replica.
+func NewPartitionedPipe(name string, checkType any, buffer int, key func(data any) string) Pipe {
+	return &balancedPipe{
+		pipe:     newPipe(name, checkType, buffer),
+		strategy: KeyHash(key),
+		key:      key,
+		subs:     make([]Filter, 0, 10),
+	}
+}
@@ -0,0 +1,115 @@
+package arch
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPartitionedState(t *testing.T) {
+	type Order struct {
+		Customer string
+		Amount   int
+	}
+	orders := NewPartitionedPipe("orders", Order{}, 1, func(data any) string {
+		return data.(Order).Customer
+	})
+	totals := NewMergePipe("totals", int(0), 1, MergeOrdered)
+	replicas := NewReplicas("aggregate", 3, func(state State, order Order) int {
+		if state.Key() != order.Customer {
+			panic(fmt.Errorf("state key '%s' for customer '%s'", state.Key(), order.Customer))
+		}
+		total := 0
+		if value, ok := state.Get(); ok {
+			total = value.(int)
+		}
+		total += order.Amount
+		state.Put(total)
+		return total
+	},
+		WithPipes(orders),
+		WithPipes(totals),
+		WithLens(),
+	)
+	model := NewModel(replicas, WithPipes(orders), WithPipes(totals))
+	model.Run()
+	customers := []string{"ana", "bob", "carl", "dora"}
+	expected := map[string]int{}
+	for i := 0; i < 20; i++ {
+		customer := customers[i%len(customers)]
+		expected[customer] += i
+		total := model.Call(WithInput(Order{customer, i}))[0].(int)
+		if total != expected[customer] {
+			t.Fatal(customer, " ", total, " != ", expected[customer])
+		}
+	}
+	model.Stop()
+	found := map[string]int{}
+	for _, state := range model.KeyedState() {
+		for customer, total := range state {
+			if _, ok := found[customer]; ok {
+				t.Fatal("customer state in two replicas: ", customer)
+			}
+			found[customer] = total.(int)
+		}
+	}
+	for customer, total := range expected {
+		if found[customer] != total {
+			t.Fatal(customer, " ", found[customer], " != ", total)
+		}
+	}
+}
+
+func TestStateUpdate(t *testing.T) {
+	numbers := NewPipe("numbers", int(0), 10)
+	counts := NewPipe("counts", int(0), 10)
+	count := NewFilterWithPipes("count", func(state State, n int) int {
+		state.Update(func(value any, ok bool) any {
+			if !ok {
+				return n
+			}
+			return value.(int) + n
+		})
+		return n
+	}, WithPipes(numbers), WithPipes(counts), WithLens())
+	if err := count.SetParallel(8); err != nil {
+		t.Fatal(err)
+	}
+	model := NewModel([]Filter{count}, WithPipes(numbers), WithPipes(counts))
+	model.Run()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			model.Call(WithInput(1))
+		}()
+	}
+	wg.Wait()
+	model.Stop()
+	if total := count.KeyedState()[""]; total != 200 {
+		t.Fatal(total, " != 200")
+	}
+}
+
+func TestStateKeyScope(t *testing.T) {
+	words := NewPartitionedPipe("words", "", 1, func(data any) string {
+		return data.(string)
+	})
+	counted := NewMergePipe("counted", "", 1, MergeOrdered)
+	keys := NewPipe("keys", "", 1)
+	counters := NewReplicas("counter", 2, func(state State, word string) string {
+		return word
+	}, WithPipes(words), WithPipes(counted), WithLens())
+	key := NewFilterWithPipes("key", func(state State, word string) string {
+		return state.Key()
+	}, WithPipes(counted), WithPipes(keys), WithLens())
+	model := NewModel(append(counters, key), WithPipes(words), WithPipes(keys))
+	model.Run()
+	defer model.Stop()
+	for _, word := range []string{"ana", "bob"} {
+		if key := model.Call(WithInput(word))[0]; key != "" {
+			t.Fatal("key of partitioned pipe leaked downstream: ", key)
+		}
+	}
+}
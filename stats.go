@@ -0,0 +1,175 @@
+package arch
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the buckets of latency histograms
+var latencyBounds = [...]time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Runtime statistics of a model, filters and pipes are indexed by name
+type Stats struct {
+	Filters map[string]FilterStats
+	Pipes   map[string]PipeStats
+}
+
+// Runtime statistics of a filter
+type FilterStats struct {
+	Processed int64         //Items processed, for most filters it's the number of calls to the function
+	Errors    int64         //Errors added to the filter
+	Busy      time.Duration //Time spent processing items
+	InFlight  int64         //Items being processed
+	Latency   Histogram     //Time spent processing every item
+}
+
+// Runtime statistics of a pipe
+type PipeStats struct {
+	Sent    int64          //Items sent through pipe
+	Buffer  int            //Size of the buffer of every subscriber
+	Depth   map[string]int //Items waiting in the buffer of every subscriber by filter name, model outputs use ""
+	Blocked time.Duration  //Time producers spent blocked because buffers were full
+}
+
+// Histogram of durations
+type Histogram struct {
+	Bounds []time.Duration //Upper bound of every bucket
+	Counts []int64         //Count of every bucket, the last one counts durations greater than the last bound
+}
+
+// Statistics collected by a filter
+type filterStats struct {
+	processed atomic.Int64
+	errors    atomic.Int64
+	busy      atomic.Int64
+	inFlight  atomic.Int64
+	latency   [len(latencyBounds) + 1]atomic.Int64
+}
+
+// Start processing an item, it returns the start time
+func (stats *filterStats) begin() time.Time {
+	stats.inFlight.Add(1)
+	return time.Now()
+}
+
+// Finish processing an item started at start time
+func (stats *filterStats) end(start time.Time) {
+	elapsed := time.Since(start)
+	bucket := len(latencyBounds)
+	for i, bound := range latencyBounds {
+		if elapsed <= bound {
+			bucket = i
+			break
+		}
+	}
+	stats.latency[bucket].Add(1)
+	stats.busy.Add(int64(elapsed))
+	stats.processed.Add(1)
+	stats.inFlight.Add(-1)
+}
+
+func (stats *filterStats) snapshot() FilterStats {
+	counts := make([]int64, len(stats.latency))
+	for i := range counts {
+		counts[i] = stats.latency[i].Load()
+	}
+	return FilterStats{
+		Processed: stats.processed.Load(),
+		Errors:    stats.errors.Load(),
+		Busy:      time.Duration(stats.busy.Load()),
+		InFlight:  stats.inFlight.Load(),
+		Latency: Histogram{
+			Bounds: append([]time.Duration(nil), latencyBounds[:]...),
+			Counts: counts,
+		},
+	}
+}
+
+// Statistics collected by a pipe
+type pipeStats struct {
+	sent    atomic.Int64
+	blocked atomic.Int64
+}
+
+// Send item to channel, it tells if the buffer was full
+func deliver(ch chan *item, it *item) bool {
+	select {
+	case ch <- it:
+		return false
+	default:
+		ch <- it
+		return true
+	}
+}
+
+// Add the time a producer spent sending an item if it was blocked
+func (stats *pipeStats) sending(start time.Time, blocked bool) {
+	stats.sent.Add(1)
+	if blocked {
+		stats.blocked.Add(int64(time.Since(start)))
+	}
+}
+
+// Statistics of pipe
+func (pipe *pipe) stats() PipeStats {
+	depth := make(map[string]int, len(pipe.conn))
+	pipe.mtxKept.Lock()
+	for filter, ch := range pipe.conn {
+		name := ""
+		if filter != nil {
+			name = filter.Name()
+		}
+		depth[name] = len(ch) + len(pipe.queued[filter])
+	}
+	pipe.mtxKept.Unlock()
+	return PipeStats{
+		Sent:    pipe.counters.sent.Load(),
+		Buffer:  pipe.buffer,
+		Depth:   depth,
+		Blocked: time.Duration(pipe.counters.blocked.Load()),
+	}
+}
+
+// Runtime statistics of every filter of the model and every pipe linked to them
+func (md *model) Stats() Stats {
+	stats := Stats{
+		Filters: make(map[string]FilterStats, len(md.filters)),
+		Pipes:   make(map[string]PipeStats),
+	}
+	add := func(pipe Pipe) bool {
+		if _, ok := stats.Pipes[pipe.Name()]; !ok {
+			stats.Pipes[pipe.Name()] = itemsOf(pipe).stats()
+		}
+		return true
+	}
+	for _, pipe := range md.inputs {
+		add(pipe)
+	}
+	for _, pipe := range md.outpus {
+		add(pipe)
+	}
+	for _, ftr := range md.filters {
+		stats.Filters[ftr.Name()] = baseOf(ftr).counters.snapshot()
+		ftr.Input().ForEach(add)
+		ftr.Output().ForEach(add)
+	}
+	return stats
+}
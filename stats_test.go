@@ -0,0 +1,90 @@
+package arch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	even := NewPipe("even", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	check := NewFilterWithPipes("check", func(n int) (int, error) {
+		if n%2 == 1 {
+			return 0, errors.New("odd")
+		}
+		return n, nil
+	}, WithPipes(in), WithPipes(even), WithLens())
+	slow := NewFilterWithPipes("slow", func(n int) int {
+		time.Sleep(time.Millisecond * 2)
+		return n
+	}, WithPipes(even), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(check, slow), WithPipes(in), WithPipes(out))
+	model.Run()
+	defer model.Stop()
+	for i := 0; i < 4; i++ {
+		model.Call(WithInput(i))
+	}
+	//Pipes count a send when it's delivered, the call could get its output before
+	stats := model.Stats()
+	for start := time.Now(); stats.Pipes["out"].Sent < 4 && time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		stats = model.Stats()
+	}
+	if checkStats := stats.Filters["check"]; checkStats.Processed != 4 || checkStats.Errors != 2 || checkStats.InFlight != 0 {
+		t.Fatal(checkStats)
+	}
+	slowStats := stats.Filters["slow"]
+	if slowStats.Processed != 2 || slowStats.Busy < time.Millisecond*4 {
+		t.Fatal(slowStats)
+	}
+	count := int64(0)
+	for _, n := range slowStats.Latency.Counts {
+		count += n
+	}
+	if count != 2 || len(slowStats.Latency.Counts) != len(slowStats.Latency.Bounds)+1 {
+		t.Fatal(slowStats.Latency)
+	}
+	if stats.Pipes["in"].Sent != 4 || stats.Pipes["out"].Sent != 4 {
+		t.Fatal(stats.Pipes)
+	}
+	if depth, ok := stats.Pipes["out"].Depth[""]; !ok || depth != 0 {
+		t.Fatal(stats.Pipes["out"])
+	}
+}
+
+func TestStatsBlocked(t *testing.T) {
+	nums := NewPipe("nums", int(0), 1)
+	n := 0
+	source := NewSourceFilter("nums", func() (int, bool) {
+		n++
+		return n, n <= 10
+	}, WithPipes(nums))
+	sink := NewSinkFilter("slow", func(int) {
+		time.Sleep(time.Millisecond * 2)
+	}, WithPipes(nums), WithLens())
+	model := NewModel(WithFilters(source, sink), WithPipes(), WithPipes())
+	model.Run()
+	model.Wait()
+	stats := model.Stats()
+	if stats.Pipes["nums"].Sent != 10 || stats.Pipes["nums"].Blocked <= 0 {
+		t.Fatal(stats.Pipes["nums"])
+	}
+	if stats.Filters["slow"].Processed != 10 {
+		t.Fatal(stats.Filters["slow"])
+	}
+}
+
+func TestStatsNameCollision(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	mid := NewPipe("mid", int(0), 1)
+	out := NewPipe("mid", int(0), 1)
+	first := NewFilterWithPipes("first", func(n int) int { return n }, WithPipes(in), WithPipes(mid), WithLens())
+	second := NewFilterWithPipes("second", func(n int) int { return n }, WithPipes(mid), WithPipes(out), WithLens())
+	defer func() {
+		if recover() == nil {
+			t.Fatal("pipes with the same name overwrite their statistics")
+		}
+	}()
+	NewModel(WithFilters(first, second), WithPipes(in), WithPipes(out))
+}
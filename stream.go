@@ -0,0 +1,127 @@
+package arch
+
+import (
+	"reflect"
+)
+
+// Length sent for the elements of a channel, the count is unknown until an end item is sent
+const streamed = -1
+
+// Represents the elements of a pipe fed to a channel parameter while the function runs
+type stream struct {
+	ch    reflect.Value
+	first chan bool //Tell if there are elements or the end, it's sent when the first element arrives
+	head  header    //Header of the first element
+	stop  chan int  //Closed when the function returns, remaining elements are dropped
+	done  chan int  //Closed when every element was received from pipe
+}
+
+// Tell if type is a receive channel used to stream elements
+func isStream(t reflect.Type) bool {
+	return t.Kind() == reflect.Chan && t.ChanDir() == reflect.RecvDir
+}
+
+// Start to feed a channel of type chType with the elements of pipe, skipped elements are not fed. When the count of
+// elements doesn't match their length the channel is closed with the elements that were received.
+func newStream(pipe Pipe, ftr *filter, chType reflect.Type, length lenItem) *stream {
+	st := &stream{
+		ch:    reflect.MakeChan(reflect.ChanOf(reflect.BothDir, chType.Elem()), 1),
+		first: make(chan bool, 1),
+		stop:  make(chan int),
+		done:  make(chan int),
+	}
+	go func() {
+		defer close(st.done)
+		defer st.ch.Close()
+		started := false
+		open, err := recvElems(pipe, ftr, length, func(it *item) {
+			if !started {
+				started = true
+				st.head = it.header
+				st.first <- true
+			}
+			if it.data == nil {
+				return
+			}
+			reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: st.ch, Send: reflect.ValueOf(it.data)},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(st.stop)},
+			})
+		})
+		if err != nil {
+			ftr.fail(err)
+		}
+		if !started {
+			st.first <- open
+		}
+	}()
+	return st
+}
+
+// Channel for the function parameter, it waits for the first element and it returns false if pipe was closed
+func (st *stream) param(paramType reflect.Type) (reflect.Value, bool) {
+	if !<-st.first {
+		return reflect.Value{}, false
+	}
+	return st.ch.Convert(paramType), true
+}
+
+// Tell if the function of filter has channel parameters, they wait for elements of the upstream filters while the
+// function runs
+func (ftr *filter) streaming() bool {
+	for _, inType := range ftr.ins {
+		if isStream(inType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tell if there are channel parameters receiving elements
+func hasStreams(streams []*stream) bool {
+	for _, st := range streams {
+		if st != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop feeding the channel and wait until every element was received from pipe
+func drainStreams(streams []*stream) {
+	for _, st := range streams {
+		if st != nil {
+			close(st.stop)
+			<-st.done
+		}
+	}
+}
+
+// Send the elements of a channel result one by one through pipe, the length is streamed and an end item is sent
+// after the last element. Balanced pipes need the count before sending, so the elements are gathered first.
+func (ftr *filter) sendStream(pipe Pipe, ch reflect.Value, head header) {
+	if _, balanced := pipe.(*balancedPipe); balanced {
+		elems := make([]any, 0, 10)
+		for !ch.IsNil() {
+			elem, ok := ch.Recv()
+			if !ok {
+				break
+			}
+			elems = append(elems, elem.Interface())
+		}
+		ftr.sendLen(pipe, len(elems), head.seq)
+		for _, elem := range elems {
+			ftr.sendItem(pipe, &item{data: elem, header: head})
+		}
+		return
+	}
+	ftr.sendLen(pipe, streamed, head.seq)
+	for !ch.IsNil() {
+		elem, ok := ch.Recv()
+		if !ok {
+			break
+		}
+		ftr.sendItem(pipe, &item{data: elem.Interface(), header: head})
+	}
+	ftr.sendItem(pipe, &item{end: true, header: head})
+}
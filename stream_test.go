@@ -0,0 +1,88 @@
+package arch
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Generate numbers from 1 to n in a channel
+func count(n int) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 1; i <= n; i++ {
+			ch <- i
+		}
+	}()
+	return ch
+}
+
+func TestStreamedOutput(t *testing.T) {
+	n := NewPipe("n", int(0), 1)
+	nums := NewPipe("nums", int(0), 1)
+	squares := NewPipe("squares", int(0), 1)
+	total := NewPipe("total", int(0), 1)
+	gen := NewFilterWithPipes("gen", count, WithPipes(n), WithPipes(nums), WithLens())
+	square := NewFilterWithPipes("square", func(x int) int { return x * x }, WithPipes(nums), WithPipes(squares), WithLens())
+	sum := NewFilterWithPipes("sum", func(squares []int) int {
+		total := 0
+		for _, sq := range squares {
+			total += sq
+		}
+		return total
+	}, WithPipes(squares), WithPipes(total), WithLens(NewLen(squares, nums)))
+	model := NewModel(WithFilters(gen, square, sum), WithPipes(n), WithPipes(total))
+	model.Run()
+	defer model.Stop()
+	for _, test := range [][2]int{{3, 14}, {0, 0}, {4, 30}} {
+		if result := model.Call(WithInput(test[0]))[0]; result != test[1] {
+			t.Fatal(test, result)
+		}
+	}
+}
+
+func TestStreamedInput(t *testing.T) {
+	words := NewPipe("words", []string{}, 1)
+	word := NewPipe("word", "", 1)
+	first := NewPipe("first", "", 1)
+	split := NewFilterWithPipes("split", func(words []string) []string { return words }, WithPipes(words), WithPipes(word), WithLens())
+	//Function stops receiving after the first element, the remaining elements are dropped
+	head := NewFilterWithPipes("head", func(words <-chan string) string {
+		for word := range words {
+			return word
+		}
+		return "none"
+	}, WithPipes(word), WithPipes(first), WithLens(NewLen(word, word)))
+	model := NewModel(WithFilters(split, head), WithPipes(words), WithPipes(first))
+	model.Run()
+	defer model.Stop()
+	results := []any{}
+	for _, input := range [][]string{{"a", "b", "c"}, {}, {"d", "e"}} {
+		results = append(results, model.Call(WithInput(input))...)
+	}
+	if fmt.Sprint(results) != "[a none d]" {
+		t.Fatal(results)
+	}
+}
+
+func TestStreamedPipeline(t *testing.T) {
+	n := NewPipe("n", int(0), 1)
+	nums := NewPipe("nums", int(0), 1)
+	total := NewPipe("total", int(0), 1)
+	gen := NewFilterWithPipes("gen", count, WithPipes(n), WithPipes(nums), WithLens())
+	sum := NewFilterWithPipes("sum", func(nums <-chan int) int {
+		total := 0
+		for num := range nums {
+			total += num
+		}
+		return total
+	}, WithPipes(nums), WithPipes(total), WithLens(NewLen(nums, nums)))
+	model := NewModel(WithFilters(gen, sum), WithPipes(n), WithPipes(total))
+	model.Run()
+	defer model.Stop()
+	for _, test := range [][2]int{{10, 55}, {0, 0}, {100, 5050}} {
+		if result := model.Call(WithInput(test[0]))[0]; result != test[1] {
+			t.Fatal(test, result)
+		}
+	}
+}
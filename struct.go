@@ -0,0 +1,85 @@
+package arch
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Link between a pipe and a field of a struct parameter or result
+type fieldLink struct {
+	param int //Index of parameter or result
+	field int //Index of field
+	slot  int //Index of pipe value in the values of the filter
+}
+
+// Marker embedded in a struct parameter or result of a filter function to destructure it: its fields with a pipe
+// tag are linked to the pipes with that name instead of linking the whole struct to a pipe.
+//
+// Structs without the marker are linked whole even if their fields have pipe tags, like the structs used with
+// GetIn and SetOut.
+type PipeFields struct{}
+
+var pipeFieldsType = reflect.TypeOf(PipeFields{})
+
+// Tell if a struct parameter or result is destructured, it embeds PipeFields
+func isDestructured(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.Anonymous && field.Type == pipeFieldsType {
+			return true
+		}
+	}
+	return false
+}
+
+// Link the fields with pipe tag of a struct to the pipes of collection, slots are appended to types
+func linkFields(ftrName string, param int, t reflect.Type, coll *collection, links map[Pipe]int, types []reflect.Type, fields []fieldLink) ([]reflect.Type, []fieldLink, error) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := field.Tag.Lookup("pipe")
+		if !ok {
+			continue
+		}
+		if !field.IsExported() {
+			return types, fields, fmt.Errorf("filter '%s' has pipe '%s' linked to unexported field '%s' of type '%s'", ftrName, name, field.Name, t)
+		}
+		pipe, err := coll.GetNamed(name)
+		if err != nil {
+			return types, fields, err
+		}
+		if !linkable(pipe.CheckType(), field.Type) {
+			return types, fields, fmt.Errorf("filter '%s' has pipe '%s' of type '%s' linked to field '%s' of type '%s'", ftrName, name, pipe.CheckType(), field.Name, field.Type)
+		}
+		if _, ok := links[pipe]; ok {
+			return types, fields, ErrPipeAllReadyInUse
+		}
+		links[pipe] = len(types)
+		fields = append(fields, fieldLink{param: param, field: i, slot: len(types)})
+		types = append(types, field.Type)
+	}
+	return types, fields, nil
+}
+
+// Fill struct parameters with the values received for their fields, it returns the function parameters
+func (ftr *filter) assemble(values []reflect.Value) []reflect.Value {
+	input := values[:ftr.fn.fnType.NumIn()]
+	for _, link := range ftr.inFields {
+		if !input[link.param].IsValid() {
+			input[link.param] = reflect.New(ftr.ins[link.param]).Elem()
+		}
+		if value := values[link.slot]; value.IsValid() {
+			input[link.param].Field(link.field).Set(value)
+		}
+	}
+	return input
+}
+
+// Append the fields of struct results to the results of the function
+func (ftr *filter) expand(output []reflect.Value) []reflect.Value {
+	for _, link := range ftr.outFields {
+		output = append(output, output[link.param].Field(link.field))
+	}
+	return output
+}
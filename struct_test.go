@@ -0,0 +1,98 @@
+package arch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type quote struct {
+	PipeFields
+	Total float64 `pipe:"total"`
+	Tax   float64 `pipe:"tax"`
+}
+
+type summary struct {
+	PipeFields
+	Total float64  `pipe:"total"`
+	Tax   float64  `pipe:"tax"`
+	Words []string `pipe:"words"`
+	Note  string   //Fields without tag keep their zero value
+}
+
+func TestStructFields(t *testing.T) {
+	price := NewPipe("price", float64(0), 1)
+	qty := NewPipe("qty", int(0), 1)
+	note := NewPipe("note", "", 1)
+	total := NewPipe("total", float64(0), 1)
+	tax := NewPipe("tax", float64(0), 1)
+	words := NewPipe("words", "", 1)
+	result := NewPipe("result", "", 1)
+	quoter := NewFilterWithPipes("quote", func(price float64, qty int) quote {
+		total := price * float64(qty)
+		return quote{Total: total, Tax: total / 10}
+	}, WithPipes(price, qty), WithPipes(total, tax), WithLens())
+	split := NewFilterWithPipes("split", strings.Fields, WithPipes(note), WithPipes(words), WithLens())
+	summarize := NewFilterWithPipes("summary", func(s summary) string {
+		return fmt.Sprintf("%.2f+%.2f %v %q", s.Total, s.Tax, s.Words, s.Note)
+	}, WithPipes(total, tax, words), WithPipes(result), WithLens(NewLen(words, words)))
+	model := NewModel(WithFilters(quoter, split, summarize), WithPipes(price, qty, note), WithPipes(result))
+	model.Run()
+	defer model.Stop()
+	if output := model.Call(WithInput(10.0, 3, "two words"))[0]; output != `30.00+3.00 [two words] ""` {
+		t.Fatal(output)
+	}
+	if output := model.Call(WithInput(1.5, 2, ""))[0]; output != `3.00+0.30 [] ""` {
+		t.Fatal(output)
+	}
+}
+
+func TestStructUnexportedField(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unexported fields can't be linked to pipes")
+		}
+	}()
+	NewFilterWithPipes("unexported", func(n int) struct {
+		PipeFields
+		value int `pipe:"out"`
+	} {
+		return struct {
+			PipeFields
+			value int `pipe:"out"`
+		}{value: n}
+	}, WithPipes(in), WithPipes(out), WithLens())
+}
+
+type order struct {
+	Price float64 `pipe:"price"`
+	Qty   int     `pipe:"qty"`
+}
+
+type invoice struct {
+	Total float64 `pipe:"total"`
+}
+
+func TestStructWhole(t *testing.T) {
+	price := NewPipe("price", float64(0), 1)
+	qty := NewPipe("qty", int(0), 1)
+	orders := NewPipe("orders", order{}, 1)
+	total := NewPipe("total", float64(0), 1)
+	//Structs without PipeFields are sent whole through a pipe even if their fields have pipe tags
+	pack := NewFilterWithPipes("pack", func(price float64, qty int) order {
+		return order{Price: price, Qty: qty}
+	}, WithPipes(price, qty), WithPipes(orders), WithLens())
+	bill := NewFilterWithPipes("bill", func(o order) float64 {
+		return o.Price * float64(o.Qty)
+	}, WithPipes(orders), WithPipes(total), WithLens())
+	md := NewModel(WithFilters(pack, bill), WithPipes(price, qty), WithPipes(total)).(*model)
+	md.Run()
+	defer md.Stop()
+	out := invoice{}
+	md.SetOut(&out, md.Call(md.GetIn(order{Price: 2.5, Qty: 4})))
+	if out.Total != 10 {
+		t.Fatal(out)
+	}
+}
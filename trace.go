@@ -0,0 +1,227 @@
+package arch
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Records a span for every filter invocation and writes them in Chrome trace-event format, traces can be opened
+// with chrome://tracing or Perfetto. Every invocation is shown in a lane of its filter with three phases: waiting
+// for inputs, executing the function and sending results. Parallel invocations use different lanes.
+//
+// A tracer keeps the last spans up to its limit, older spans are overwritten (see SetLimit).
+type Tracer struct {
+	mtx    sync.Mutex
+	origin time.Time
+	spans  []*span //Ring of recorded spans, next is the oldest one when it's full
+	next   int
+	limit  int
+	lanes  map[string][]bool //Busy lanes of every filter
+	tids   map[laneKey]int   //Thread id of every lane in the trace
+	names  []laneKey         //Lanes in the order of their thread ids
+}
+
+// Lane of a filter
+type laneKey struct {
+	filter string
+	lane   int
+}
+
+// Represents a filter invocation
+type span struct {
+	tracer   *Tracer
+	filter   string
+	lane     int
+	seq      uint64
+	failed   string
+	skipped  bool
+	start    time.Time //Start waiting for inputs
+	received time.Time //Every input was received, function starts
+	executed time.Time //Function returned
+	sending  time.Time //Start sending results, it's later than executed when results wait for previous calls
+	sent     time.Time //Results were sent
+}
+
+// Spans kept by a tracer by default
+const defaultSpanLimit = 100000
+
+// Create a tracer, it's enabled with the SetTracer method of a model before running it
+func NewTracer() *Tracer {
+	return &Tracer{
+		origin: time.Now(),
+		spans:  make([]*span, 0, 100),
+		limit:  defaultSpanLimit,
+		lanes:  make(map[string][]bool),
+		tids:   make(map[laneKey]int),
+	}
+}
+
+// Start a span for filter, a nil tracer returns a nil span that records nothing
+func (tr *Tracer) begin(filter string) *span {
+	if tr == nil {
+		return nil
+	}
+	tr.mtx.Lock()
+	defer tr.mtx.Unlock()
+	lanes := tr.lanes[filter]
+	lane := 0
+	for lane < len(lanes) && lanes[lane] {
+		lane++
+	}
+	if lane == len(lanes) {
+		lanes = append(lanes, true)
+		key := laneKey{filter: filter, lane: lane}
+		tr.tids[key] = len(tr.names) + 1
+		tr.names = append(tr.names, key)
+	} else {
+		lanes[lane] = true
+	}
+	tr.lanes[filter] = lanes
+	return &span{tracer: tr, filter: filter, lane: lane, start: time.Now()}
+}
+
+// Every input was received for call with sequence seq
+func (sp *span) receive(seq uint64) {
+	if sp != nil {
+		sp.seq = seq
+		sp.received = time.Now()
+	}
+}
+
+// Function returned with err, or it wasn't called because an input was unset
+func (sp *span) execute(err error, unset bool) {
+	if sp != nil {
+		sp.executed = time.Now()
+		sp.skipped = unset
+		if err != nil {
+			sp.failed = err.Error()
+		}
+	}
+}
+
+// Start sending results
+func (sp *span) send() {
+	if sp != nil {
+		sp.sending = time.Now()
+	}
+}
+
+// Results were sent, the span is recorded and its lane is released
+func (sp *span) finish() {
+	if sp != nil {
+		sp.sent = time.Now()
+		sp.release(true)
+	}
+}
+
+// The invocation didn't happen, its lane is released and nothing is recorded
+func (sp *span) discard() {
+	if sp != nil {
+		sp.release(false)
+	}
+}
+
+func (sp *span) release(record bool) {
+	tr := sp.tracer
+	tr.mtx.Lock()
+	defer tr.mtx.Unlock()
+	tr.lanes[sp.filter][sp.lane] = false
+	if !record {
+		return
+	}
+	if len(tr.spans) < tr.limit {
+		tr.spans = append(tr.spans, sp)
+		return
+	}
+	tr.spans[tr.next] = sp
+	tr.next = (tr.next + 1) % len(tr.spans)
+}
+
+// Set the number of spans kept by tracer, the oldest spans are overwritten by new ones. It removes recorded spans.
+func (tr *Tracer) SetLimit(limit int) {
+	tr.mtx.Lock()
+	defer tr.mtx.Unlock()
+	if limit < 1 {
+		limit = 1
+	}
+	tr.limit = limit
+	tr.spans = tr.spans[:0]
+	tr.next = 0
+}
+
+// Remove recorded spans
+func (tr *Tracer) Reset() {
+	tr.mtx.Lock()
+	defer tr.mtx.Unlock()
+	tr.spans = tr.spans[:0]
+	tr.next = 0
+}
+
+// Recorded spans from the oldest to the newest, it must be called with the tracer lock
+func (tr *Tracer) recorded() []*span {
+	return append(append([]*span{}, tr.spans[tr.next:]...), tr.spans[:tr.next]...)
+}
+
+// Event of Chrome trace-event format
+type traceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	Ts   float64        `json:"ts"`
+	Dur  float64        `json:"dur"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// Write recorded spans as a JSON object with trace events, timestamps are microseconds since the tracer was created
+func (tr *Tracer) Write(out io.Writer) error {
+	tr.mtx.Lock()
+	events := make([]traceEvent, 0, len(tr.names)+3*len(tr.spans)+1)
+	events = append(events, traceEvent{Name: "process_name", Ph: "M", Pid: 1, Args: map[string]any{"name": "pipfil"}})
+	for i, key := range tr.names {
+		name := key.filter
+		if key.lane > 0 {
+			name = name + " #" + strconv.Itoa(key.lane)
+		}
+		events = append(events, traceEvent{Name: "thread_name", Ph: "M", Pid: 1, Tid: i + 1, Args: map[string]any{"name": name}})
+	}
+	for _, sp := range tr.recorded() {
+		tid := tr.tids[laneKey{filter: sp.filter, lane: sp.lane}]
+		args := map[string]any{"seq": sp.seq}
+		events = append(events, tr.event("wait", "wait", sp.start, sp.received, tid, args))
+		exec := map[string]any{"seq": sp.seq}
+		if sp.skipped {
+			exec["skipped"] = true
+		}
+		if sp.failed != "" {
+			exec["error"] = sp.failed
+		}
+		events = append(events, tr.event(sp.filter, "exec", sp.received, sp.executed, tid, exec))
+		events = append(events, tr.event("send", "send", sp.sending, sp.sent, tid, args))
+	}
+	tr.mtx.Unlock()
+	w := bufio.NewWriter(out)
+	if err := json.NewEncoder(w).Encode(map[string]any{"traceEvents": events, "displayTimeUnit": "ms"}); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Complete event between start and end
+func (tr *Tracer) event(name, cat string, start, end time.Time, tid int, args map[string]any) traceEvent {
+	return traceEvent{
+		Name: name,
+		Cat:  cat,
+		Ph:   "X",
+		Ts:   float64(start.Sub(tr.origin).Nanoseconds()) / 1e3,
+		Dur:  float64(end.Sub(start).Nanoseconds()) / 1e3,
+		Pid:  1,
+		Tid:  tid,
+		Args: args,
+	}
+}
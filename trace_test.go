@@ -0,0 +1,112 @@
+package arch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	slow := NewFilterWithPipes("slow", func(n int) int {
+		time.Sleep(time.Millisecond * 5)
+		return n
+	}, WithPipes(in), WithPipes(out), WithLens())
+	slow.SetParallel(4)
+	tracer := NewTracer()
+	model := NewModel(WithFilters(slow), WithPipes(in), WithPipes(out))
+	model.SetTracer(tracer)
+	model.Run()
+	defer model.Stop()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			model.Call(WithInput(i))
+		}(i)
+	}
+	wg.Wait()
+	waitSpans(tracer, 8)
+	buf := bytes.NewBuffer(nil)
+	if err := tracer.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	trace := struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatal(err)
+	}
+	phases := make(map[string]int)
+	lanes := make(map[int]bool)
+	seqs := make(map[float64]bool)
+	for _, event := range trace.TraceEvents {
+		if event.Ph != "X" {
+			continue
+		}
+		phases[event.Cat]++
+		if event.Cat == "exec" {
+			if event.Name != "slow" || event.Dur < 5000 {
+				t.Fatal(event)
+			}
+			lanes[event.Tid] = true
+			seqs[event.Args["seq"].(float64)] = true
+		}
+	}
+	if phases["wait"] != 8 || phases["exec"] != 8 || phases["send"] != 8 || len(seqs) != 8 {
+		t.Fatal(phases, seqs)
+	}
+	if len(lanes) < 2 {
+		t.Fatal("parallel invocations must use different lanes", lanes)
+	}
+	tracer.Reset()
+	buf.Reset()
+	tracer.Write(buf)
+	if bytes.Contains(buf.Bytes(), []byte(`"ph":"X"`)) {
+		t.Fatal(buf.String())
+	}
+}
+
+// Wait until tracer recorded count spans, the span of a call is recorded after its results are sent
+func waitSpans(tracer *Tracer, count int) []*span {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		tracer.mtx.Lock()
+		recorded := len(tracer.spans) + tracer.next
+		tracer.mtx.Unlock()
+		if recorded >= count {
+			break
+		}
+	}
+	tracer.mtx.Lock()
+	defer tracer.mtx.Unlock()
+	return tracer.recorded()
+}
+
+func TestTracerLimit(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	inc := NewFilterWithPipes("inc", func(n int) int {
+		return n + 1
+	}, WithPipes(in), WithPipes(out), WithLens())
+	tracer := NewTracer()
+	tracer.SetLimit(3)
+	model := NewModel(WithFilters(inc), WithPipes(in), WithPipes(out))
+	model.SetTracer(tracer)
+	model.Run()
+	defer model.Stop()
+	for i := 0; i < 5; i++ {
+		model.Call(WithInput(i))
+	}
+	seqs := []uint64{}
+	for _, sp := range waitSpans(tracer, 5) {
+		seqs = append(seqs, sp.seq)
+	}
+	if fmt.Sprint(seqs) != "[3 4 5]" {
+		t.Fatal("tracer must keep the last spans: ", seqs)
+	}
+}
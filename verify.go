@@ -0,0 +1,135 @@
+package arch
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// It's produced when the number of elements received from a pipe for a slice doesn't match the length sent for
+// them, for example when a filter that processes the elements one by one doesn't send a result for every one.
+//
+// When elements are missing the filter skips its function for that call and the elements of the next call are
+// kept for it, when there are more elements than the length they are dropped, so the model doesn't hang. Elements
+// missing in the last call are detected when the model is stopped or when they don't arrive in the length timeout
+// of the model (see SetLengthTimeout).
+type LengthMismatchError struct {
+	Filter   string //Filter that receives the elements
+	Pipe     string //Pipe of the elements
+	Seq      uint64 //Call of the elements
+	Expected int    //Length sent for the elements
+	Received int    //Elements received
+}
+
+func (err *LengthMismatchError) Error() string {
+	return fmt.Sprintf("filter '%s' received %d elements from pipe '%s' in call %d but their length is %d", err.Filter, err.Received, err.Pipe, err.Seq, err.Expected)
+}
+
+// Elements received from a pipe for the last slice
+type batch struct {
+	lenItem
+	received int
+}
+
+// Receive the elements of a slice sent one by one through pipe, length is received before with the call of the
+// elements and it could be streamed. When the call of the elements is known they are checked against the length.
+// When the model is called with priorities the elements of other calls arrive interleaved, so the elements of the
+// call of length are received and the others keep waiting for their own lengths.
+// It returns false if pipe was closed, elements that don't arrive before filter is stopped or before the length
+// timeout are missing.
+func recvElems(pipe Pipe, ftr *filter, length lenItem, each func(it *item)) (bool, error) {
+	received := 0
+	stale := map[uint64]int{}
+	//Dropped elements are reported with the last slice before setting this one
+	defer func() {
+		ftr.dropped(pipe, stale)
+		ftr.received(pipe, batch{length, received})
+	}()
+	seq := uint64(0)
+	if ftr.prioritized != nil && ftr.prioritized.Load() && ftr.byCall[pipe] {
+		seq = length.seq
+	}
+	for length.count == streamed || received < length.count {
+		var stop chan int
+		if ftr.sg != nil {
+			stop = ftr.sg.stop
+		}
+		done := ftr.waitFor(OpGet, pipe)
+		it, ok := itemsOf(pipe).recvCallWithin(ftr, seq, stop, ftr.elemTimeout)
+		done()
+		if !ok {
+			//No item of a later call tells that elements are missing, the call could be the last one
+			return true, &LengthMismatchError{Filter: ftr.name, Pipe: pipe.Name(), Seq: length.seq, Expected: length.count, Received: received}
+		}
+		if it == nil {
+			return false, nil
+		}
+		if length.seq != 0 && it.seq != 0 {
+			if it.seq < length.seq {
+				stale[it.seq]++ //more elements than the length of a previous call
+				continue
+			}
+			if it.seq > length.seq {
+				//less elements than the length, the item is the first of the next call
+				itemsOf(pipe).unrecv(ftr, it)
+				return true, &LengthMismatchError{Filter: ftr.name, Pipe: pipe.Name(), Seq: length.seq, Expected: length.count, Received: received}
+			}
+		}
+		ftr.arrived(pipe, it)
+		if it.end {
+			break
+		}
+		each(it)
+		received++
+	}
+	return true, nil
+}
+
+// Set the time every filter waits for an element of a slice, when it doesn't arrive the elements are missing and the
+// filter skips its function for that call. Zero waits until the element arrives.
+func (md *model) SetLengthTimeout(timeout time.Duration) {
+	for i := range md.filters {
+		baseOf(md.filters[i]).elemTimeout = timeout
+	}
+}
+
+// Set the last slice received from pipe
+func (ftr *filter) received(pipe Pipe, last batch) {
+	ftr.mtxBatch.Lock()
+	defer ftr.mtxBatch.Unlock()
+	ftr.batches[pipe] = last
+}
+
+// Add errors for elements dropped from pipe because they were more than the length of their call
+func (ftr *filter) dropped(pipe Pipe, stale map[uint64]int) {
+	if len(stale) == 0 {
+		return
+	}
+	ftr.mtxBatch.Lock()
+	last := ftr.batches[pipe]
+	ftr.mtxBatch.Unlock()
+	seqs := make([]uint64, 0, len(stale))
+	for seq := range stale {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		err := &LengthMismatchError{Filter: ftr.name, Pipe: pipe.Name(), Seq: seq, Received: stale[seq]}
+		if seq == last.seq {
+			err.Expected = last.count
+			err.Received += last.received
+		}
+		ftr.fail(err)
+	}
+}
+
+// Add error to filter errors
+func (ftr *filter) fail(err error) {
+	ftr.counters.errors.Add(1)
+	if hooks := ftr.hooks.Load(); hooks != nil && hooks.OnError != nil {
+		hooks.OnError(ftr.name, err)
+	}
+	ftr.lck <- 0
+	ftr.errs = append(ftr.errs, err)
+	<-ftr.lck
+}
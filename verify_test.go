@@ -0,0 +1,68 @@
+package arch
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLengthMismatch(t *testing.T) {
+	nums := NewPipe("nums", []int{}, 10)
+	parts := NewPipe("parts", int(0), 10)
+	evens := NewPipe("evens", int(0), 10)
+	windows := NewPipe("windows", int(0), 10)
+	kept := NewPipe("kept", int(0), 10)
+	sums := NewPipe("sums", int(0), 10)
+	split := NewFilterWithPipes("split", func(nums []int) []int {
+		return nums
+	}, WithPipes(nums), WithPipes(parts), WithLens())
+	even := NewFilterWithPipes("even", func(n int) Optional[int] {
+		if n%2 != 0 {
+			return None[int]()
+		}
+		return Some(n)
+	}, WithPipes(parts), WithPipes(evens), WithLens())
+	//Windows drop skipped items, so odd numbers never reach the sum
+	drop := NewCountWindow("drop", evens, windows, 1)
+	first := NewFilterWithPipes("first", func(window []int) int {
+		return window[0]
+	}, WithPipes(windows), WithPipes(kept), WithLens(NewLen(windows, windows)))
+	sum := NewFilterWithPipes("sum", func(nums []int) int {
+		total := 0
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	}, WithPipes(kept), WithPipes(sums), WithLens(NewLen(kept, parts)))
+	model := NewModel(WithFilters(split, even, drop, first, sum), WithPipes(nums), WithPipes(sums))
+	model.SetLengthTimeout(time.Millisecond * 100)
+	model.Run()
+	defer model.Stop()
+	if total := model.Call(WithInput([]int{2, 4}))[0]; total != 6 {
+		t.Fatal(total)
+	}
+	//The element dropped in the last call is missing, no later call tells it
+	result := make(chan []any)
+	go func() { result <- model.Call(WithInput([]int{2, 3})) }()
+	select {
+	case output := <-result:
+		if output[0] != nil {
+			t.Fatal(output)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call with a missing element hangs")
+	}
+	if total := model.Call(WithInput([]int{8}))[0]; total != 8 {
+		t.Fatal(total)
+	}
+	errs := sum.Errs()
+	if len(errs) != 1 {
+		t.Fatal(errs)
+	}
+	var mismatch *LengthMismatchError
+	expected := LengthMismatchError{Filter: "sum", Pipe: "kept", Seq: 2, Expected: 2, Received: 1}
+	if !errors.As(errs[0], &mismatch) || *mismatch != expected {
+		t.Fatal(fmt.Sprint(errs[0]))
+	}
+}
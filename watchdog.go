@@ -0,0 +1,282 @@
+package arch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations of pipes that block filters
+const (
+	OpGet    = "Get"    //Filter waits for an item of a pipe
+	OpLen    = "Len"    //Filter waits for a length of a pipe
+	OpSet    = "Set"    //Filter waits for room in the buffers of a pipe to send an item
+	OpSetLen = "SetLen" //Filter waits for room in the buffers of a pipe to send a length
+)
+
+// Operation of a pipe that blocks a filter
+type Blocked struct {
+	Op   string        //OpGet, OpLen, OpSet or OpSetLen
+	Pipe string        //Pipe of the operation
+	For  time.Duration //Time blocked
+}
+
+// Operations that block a filter, a filter without them is running its function or it's polling its inputs
+type FilterBlocked struct {
+	Filter  string
+	Blocked []Blocked
+}
+
+// Buffer depths of a pipe
+type PipeDepth struct {
+	Pipe   string
+	Buffer int            //Size of the buffer of every subscriber
+	Depth  map[string]int //Items waiting in the buffer of every subscriber by filter name, model outputs use ""
+}
+
+// State of a model that made no progress, filters and pipes are sorted by name. Filters and pipes of the bodies of
+// loops are prefixed with the name of their loop, like "loop/filter".
+type StallReport struct {
+	Stalled  time.Duration //Time without progress
+	InFlight int           //Calls waiting for their outputs
+	Filters  []FilterBlocked
+	Pipes    []PipeDepth
+}
+
+// Human-readable report
+func (report StallReport) String() string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "no progress for %s, %d calls in flight\n", report.Stalled, report.InFlight)
+	sb.WriteString("filters:\n")
+	for _, ftr := range report.Filters {
+		if len(ftr.Blocked) == 0 {
+			fmt.Fprintf(&sb, "  %s: not blocked on pipes\n", ftr.Filter)
+			continue
+		}
+		for _, blocked := range ftr.Blocked {
+			fmt.Fprintf(&sb, "  %s: %s '%s' for %s\n", ftr.Filter, blocked.Op, blocked.Pipe, blocked.For)
+		}
+	}
+	sb.WriteString("pipes:\n")
+	for _, pipe := range report.Pipes {
+		subscribers := make([]string, 0, len(pipe.Depth))
+		for name := range pipe.Depth {
+			subscribers = append(subscribers, name)
+		}
+		sort.Strings(subscribers)
+		depths := make([]string, 0, len(subscribers))
+		for _, name := range subscribers {
+			if name == "" {
+				depths = append(depths, fmt.Sprintf("model output %d", pipe.Depth[name]))
+			} else {
+				depths = append(depths, fmt.Sprintf("%s %d", name, pipe.Depth[name]))
+			}
+		}
+		fmt.Fprintf(&sb, "  %s (buffer %d): %s\n", pipe.Pipe, pipe.Buffer, strings.Join(depths, ", "))
+	}
+	return sb.String()
+}
+
+// Operations that block a filter, they are tracked only when a watchdog is set
+type waits struct {
+	mtx  sync.Mutex
+	next int
+	ops  map[int]waiting
+}
+
+type waiting struct {
+	op, pipe string
+	since    time.Time
+}
+
+func noWait() {}
+
+// Track an operation of pipe that could block filter, the returned function must be called when it finishes
+func (ftr *filter) waitFor(op string, pipe Pipe) func() {
+	ws := ftr.waits
+	if ws == nil {
+		return noWait
+	}
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	id := ws.next
+	ws.next++
+	ws.ops[id] = waiting{op: op, pipe: pipe.Name(), since: time.Now()}
+	return func() {
+		ws.mtx.Lock()
+		defer ws.mtx.Unlock()
+		delete(ws.ops, id)
+	}
+}
+
+// Operations of pipes that block filter now, the oldest first
+func (ftr *filter) blocked(now time.Time) []Blocked {
+	ws := ftr.waits
+	if ws == nil {
+		return nil
+	}
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	blocked := make([]Blocked, 0, len(ws.ops))
+	for _, op := range ws.ops {
+		blocked = append(blocked, Blocked{Op: op.op, Pipe: op.pipe, For: now.Sub(op.since)})
+	}
+	sort.Slice(blocked, func(i, j int) bool {
+		if blocked[i].For != blocked[j].For {
+			return blocked[i].For > blocked[j].For
+		}
+		return blocked[i].Pipe < blocked[j].Pipe
+	})
+	return blocked
+}
+
+// Send length through pipe tracking the operation
+func (ftr *filter) sendLen(pipe Pipe, length int, seq uint64) {
+	done := ftr.waitFor(OpSetLen, pipe)
+	itemsOf(pipe).sendLen(length, seq)
+	done()
+}
+
+// Watch a model for stalls
+type watchdog struct {
+	after   time.Duration
+	onStall func(StallReport)
+}
+
+// Detect when the model makes no progress for after duration while there is pending work (calls in flight, items
+// in buffers or filters blocked sending), onStall is called with a report once for every stall. It must be called
+// before Run, operations of pipes that block filters are tracked only with a watchdog.
+func (md *model) SetWatchdog(after time.Duration, onStall func(StallReport)) {
+	md.watchdog = &watchdog{after: after, onStall: onStall}
+	md.instrument()
+}
+
+// Track the operations of pipes that block the filters of model and of the bodies of its loops
+func (md *model) instrument() {
+	for _, ftr := range md.filters {
+		baseOf(ftr).waits = &waits{ops: make(map[int]waiting)}
+		if lp, ok := ftr.(*loop); ok {
+			lp.body.(*model).instrument()
+		}
+	}
+}
+
+// Statistics of model and of the bodies of its loops, the filters and pipes of a body are prefixed with the name of
+// its loop, like "loop/filter"
+func (md *model) nestedStats() Stats {
+	stats := md.Stats()
+	for _, ftr := range md.filters {
+		if lp, ok := ftr.(*loop); ok {
+			body := lp.body.(*model).nestedStats()
+			for name, filter := range body.Filters {
+				stats.Filters[lp.name+"/"+name] = filter
+			}
+			for name, pipe := range body.Pipes {
+				stats.Pipes[lp.name+"/"+name] = pipe
+			}
+		}
+	}
+	return stats
+}
+
+// Operations that block the filters of model and of the bodies of its loops, prefix is the path of the loops
+func (md *model) nestedBlocked(now time.Time, prefix string) []FilterBlocked {
+	filters := make([]FilterBlocked, 0, len(md.filters))
+	for _, ftr := range md.filters {
+		filters = append(filters, FilterBlocked{Filter: prefix + ftr.Name(), Blocked: baseOf(ftr).blocked(now)})
+		if lp, ok := ftr.(*loop); ok {
+			filters = append(filters, lp.body.(*model).nestedBlocked(now, prefix+lp.name+"/")...)
+		}
+	}
+	return filters
+}
+
+// Report of the filters and pipes of model, stalled is the time without progress
+func (md *model) stallReport(stalled time.Duration) StallReport {
+	now := time.Now()
+	stats := md.nestedStats()
+	md.mtxCalls.Lock()
+	inFlight := len(md.calls)
+	md.mtxCalls.Unlock()
+	report := StallReport{
+		Stalled:  stalled,
+		InFlight: inFlight,
+		Filters:  md.nestedBlocked(now, ""),
+		Pipes:    make([]PipeDepth, 0, len(stats.Pipes)),
+	}
+	for name, pipe := range stats.Pipes {
+		report.Pipes = append(report.Pipes, PipeDepth{Pipe: name, Buffer: pipe.Buffer, Depth: pipe.Depth})
+	}
+	sort.Slice(report.Filters, func(i, j int) bool { return report.Filters[i].Filter < report.Filters[j].Filter })
+	sort.Slice(report.Pipes, func(i, j int) bool { return report.Pipes[i].Pipe < report.Pipes[j].Pipe })
+	return report
+}
+
+// Tell if the report has pending work, a model waiting for calls is idle but not stalled
+func (report StallReport) pending() bool {
+	if report.InFlight > 0 {
+		return true
+	}
+	for _, ftr := range report.Filters {
+		for _, blocked := range ftr.Blocked {
+			if blocked.Op == OpSet || blocked.Op == OpSetLen {
+				return true
+			}
+		}
+	}
+	for _, pipe := range report.Pipes {
+		for _, depth := range pipe.Depth {
+			if depth > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Items processed and sent by the model, it grows while the model makes progress
+func progress(stats Stats) int64 {
+	total := int64(0)
+	for _, ftr := range stats.Filters {
+		total += ftr.Processed
+	}
+	for _, pipe := range stats.Pipes {
+		total += pipe.Sent
+	}
+	return total
+}
+
+// Poll progress of model until it's stopped or every filter is finished
+func (md *model) watch(wd *watchdog) {
+	interval := wd.after / 4
+	if interval < time.Millisecond*10 {
+		interval = time.Millisecond * 10
+	}
+	poll := time.NewTicker(interval)
+	defer poll.Stop()
+	last, since, reported := progress(md.nestedStats()), time.Now(), false
+	for {
+		select {
+		case <-md.quit:
+			return
+		case <-md.singal.(*signal).done:
+			return
+		case now := <-poll.C:
+			if current := progress(md.nestedStats()); current != last {
+				last, since, reported = current, now, false
+				continue
+			}
+			if reported || now.Sub(since) < wd.after {
+				continue
+			}
+			if report := md.stallReport(now.Sub(since)); report.pending() {
+				reported = true
+				wd.onStall(report)
+			} else {
+				since = now //idle models are not stalled
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package arch
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	nums := NewPipe("nums", int(0), 1)
+	n := 0
+	source := NewSourceFilter("nums", func() (int, bool) {
+		n++
+		return n, n <= 5
+	}, WithPipes(nums))
+	release := make(chan int)
+	sink := NewSinkFilter("stuck", func(int) {
+		<-release
+	}, WithPipes(nums), WithLens())
+	reports := make(chan StallReport, 1)
+	model := NewModel(WithFilters(source, sink), WithPipes(), WithPipes())
+	model.SetWatchdog(time.Millisecond*50, func(report StallReport) {
+		reports <- report
+	})
+	model.Run()
+	var report StallReport
+	select {
+	case report = <-reports:
+	case <-time.After(time.Second * 5):
+		t.Fatal("stall not reported")
+	}
+	close(release)
+	model.Wait()
+	if report.Stalled < time.Millisecond*50 || len(report.Filters) != 2 || len(report.Pipes) != 1 {
+		t.Fatal(report)
+	}
+	if blocked := report.Filters[0]; blocked.Filter != "nums" || len(blocked.Blocked) != 1 || blocked.Blocked[0].Op != OpSet || blocked.Blocked[0].Pipe != "nums" {
+		t.Fatal(blocked)
+	}
+	if blocked := report.Filters[1]; blocked.Filter != "stuck" || len(blocked.Blocked) != 0 {
+		t.Fatal(blocked)
+	}
+	if pipe := report.Pipes[0]; pipe.Pipe != "nums" || pipe.Buffer != 1 || pipe.Depth["stuck"] != 1 {
+		t.Fatal(pipe)
+	}
+	text := report.String()
+	for _, line := range []string{"nums: Set 'nums' for", "stuck: not blocked on pipes", "nums (buffer 1): stuck 1"} {
+		if !strings.Contains(text, line) {
+			t.Fatal(line, "\n", text)
+		}
+	}
+}
+
+func TestWatchdogIdle(t *testing.T) {
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	double := NewFilterWithPipes("double", func(n int) int { return n * 2 }, WithPipes(in), WithPipes(out), WithLens())
+	model := NewModel(WithFilters(double), WithPipes(in), WithPipes(out))
+	stalls := make(chan StallReport, 1)
+	model.SetWatchdog(time.Millisecond*20, func(report StallReport) {
+		stalls <- report
+	})
+	model.Run()
+	defer model.Stop()
+	if output := model.Call(WithInput(2)); output[0] != 4 {
+		t.Fatal(output)
+	}
+	//A model waiting for calls is idle, filters wait for items but there is no pending work
+	select {
+	case report := <-stalls:
+		t.Fatal(report)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestWatchdogLoop(t *testing.T) {
+	state := NewPipe("state", int(0), 1)
+	next := NewPipe("next", int(0), 1)
+	release := make(chan int)
+	step := NewFilterWithPipes("step", func(n int) int {
+		if n < 0 {
+			<-release
+		}
+		time.Sleep(time.Millisecond * 10)
+		return n + 1
+	}, WithPipes(state), WithPipes(next), WithLens())
+	body := NewModel(WithFilters(step), WithPipes(state), WithPipes(next))
+	in := NewPipe("in", int(0), 1)
+	out := NewPipe("out", int(0), 1)
+	iterate := NewLoop[int]("iterate", in, out, body, nil, 60)
+	model := NewModel(WithFilters(iterate), WithPipes(in), WithPipes(out))
+	reports := make(chan StallReport, 1)
+	model.SetWatchdog(time.Millisecond*250, func(report StallReport) {
+		reports <- report
+	})
+	model.Run()
+	defer model.Stop()
+	//Iterations of the body are progress of the model
+	if output := model.Call(WithInput(0)); output[0] != 60 {
+		t.Fatal(output)
+	}
+	select {
+	case report := <-reports:
+		t.Fatal("loop iterating reported as stalled\n", report)
+	default:
+	}
+	go model.Call(WithInput(-1))
+	var report StallReport
+	select {
+	case report = <-reports:
+	case <-time.After(time.Second * 5):
+		t.Fatal("stall in loop body not reported")
+	}
+	close(release)
+	text := report.String()
+	for _, line := range []string{"iterate: not blocked on pipes", "iterate/step: not blocked on pipes", "iterate/state (buffer 1)"} {
+		if !strings.Contains(text, line) {
+			t.Fatal(line, "\n", text)
+		}
+	}
+}
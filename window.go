@@ -0,0 +1,219 @@
+package arch
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// It's produced with panic when a window has no positive size, slide or duration, when its slide is greater
+// than its size, or when its input and output pipes have different types
+var ErrWindowDefinition = errors.New("window definition error")
+
+// Implemented by filters that hold pending items, like windows
+type Flusher interface {
+	Flush() //Send pending items
+}
+
+// Represents a window that gathers items from a pipe into slices.
+//
+// Time reducers are windows that fold items into an accumulator instead of gathering them.
+//
+// The window sends every slice through its output pipe element by element with its length, like a filter
+// that returns a slice, so a filter can receive it in a slice parameter using the output pipe as its own length.
+type window struct {
+	*filter
+	in, out Pipe
+	size    int           //Items in a window, zero for time windows
+	slide   int           //Items between the start of two windows
+	every   time.Duration //Duration of time windows, zero for count windows
+	fold    *folder       //Fold of reducers, nil for windows
+	acc     any
+	head    header
+	pending []*item
+	fresh   int //Pending items that were not sent in a window
+	flush   chan chan int
+	exited  chan int
+	running bool
+	mtxRun  sync.Mutex
+}
+
+// Create a tumbling window that sends a slice every size items
+func NewCountWindow(name string, in, out Pipe, size int) Filter {
+	return newWindow(name, in, out, size, size, 0, nil)
+}
+
+// Create a sliding window that sends a slice with the last size items every slide items, windows overlap when
+// slide is lesser than size
+func NewSlidingWindow(name string, in, out Pipe, size, slide int) Filter {
+	return newWindow(name, in, out, size, slide, 0, nil)
+}
+
+// Create a tumbling window that sends a slice with the items received every duration
+func NewTimeWindow(name string, in, out Pipe, every time.Duration) Filter {
+	return newWindow(name, in, out, 0, 0, every, nil)
+}
+
+func newWindow(name string, in, out Pipe, size, slide int, every time.Duration, fold *folder) *window {
+	if fold == nil && ((every <= 0 && (size <= 0 || slide <= 0 || slide > size)) || in.CheckType() != out.CheckType()) {
+		panic(ErrWindowDefinition)
+	}
+	//Function is never called, it describes window for the model checks
+	outType := reflect.SliceOf(in.CheckType())
+	if fold != nil {
+		outType = fold.accType
+	}
+	fnType := reflect.FuncOf([]reflect.Type{in.CheckType()}, []reflect.Type{outType}, false)
+	fn := reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.Zero(outType)}
+	})
+	ftr := NewFilterWithPipes(name, fn.Interface(), WithPipes(in), WithPipes(out), WithLens())
+	return &window{
+		filter:  baseOf(ftr),
+		in:      in,
+		out:     out,
+		size:    size,
+		slide:   slide,
+		every:   every,
+		fold:    fold,
+		pending: make([]*item, 0, size),
+		flush:   make(chan chan int),
+		exited:  make(chan int),
+	}
+}
+
+// Run window, pending items are sent when input pipe is closed
+func (win *window) Run() {
+	ftr := win.filter
+	if !ftr.compiled {
+		panic(ErrFilterNotCompiled)
+	}
+	ftr.started()
+	defer ftr.stopped()
+	win.setRunning(true)
+	defer close(win.exited)
+	defer ftr.closeInputs()
+	defer ftr.output.Close()
+	items := itemsOf(win.in).channel(ftr)
+	var tick <-chan time.Time
+	if win.every > 0 {
+		ticker := time.NewTicker(win.every)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var stop chan int
+	if ftr.sg != nil {
+		stop = ftr.sg.stop
+	}
+	for {
+		select {
+		case it, ok := <-items:
+			if !ok {
+				win.emit(len(win.pending))
+				return
+			}
+			win.add(it)
+		case <-tick:
+			win.emit(len(win.pending))
+		case done := <-win.flush:
+			//Items sent to pipe before flushing are part of the window, later items of a source that keeps
+			//producing are not
+			for drain := len(items); drain > 0; drain-- {
+				it, ok := <-items
+				if !ok {
+					break
+				}
+				win.add(it)
+			}
+			win.emit(len(win.pending))
+			done <- 0
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Add item to pending items, it sends a window when it's full
+func (win *window) add(it *item) {
+	win.arrived(win.in, it)
+	if it.data == nil {
+		return //skipped items are not part of windows
+	}
+	defer win.counters.end(win.counters.begin())
+	win.fresh++
+	if win.fold != nil {
+		//Reducers keep the accumulator instead of the items
+		if win.fresh == 1 {
+			win.acc = win.fold.init()
+			win.head = header{}
+		}
+		win.share.acquire()
+		win.acc = win.fold.step(win.acc, it.data)
+		win.share.release()
+		win.head = win.head.merge(it.header)
+		return
+	}
+	win.pending = append(win.pending, it)
+	if win.size > 0 && len(win.pending) == win.size {
+		win.emit(win.slide)
+	}
+}
+
+// Send pending items as a slice and remove the first items of pending
+func (win *window) emit(remove int) {
+	if win.fresh == 0 {
+		return
+	}
+	win.fresh = 0
+	//Windows join items of several tickets, so their results can't be reassembled by ticket
+	if win.fold != nil {
+		head := win.head
+		head.ticket = 0
+		win.filter.send([]reflect.Value{win.fold.value(win.acc)}, head, nil, false)
+		return
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(win.in.CheckType()), len(win.pending), len(win.pending))
+	head := header{}
+	for i, it := range win.pending {
+		slice.Index(i).Set(reflect.ValueOf(it.data))
+		head = head.merge(it.header)
+	}
+	if remove > len(win.pending) {
+		remove = len(win.pending)
+	}
+	win.pending = append(win.pending[:0], win.pending[remove:]...)
+	head.ticket = 0
+	win.filter.send([]reflect.Value{slice}, head, nil, false)
+}
+
+func (win *window) setRunning(running bool) {
+	win.mtxRun.Lock()
+	defer win.mtxRun.Unlock()
+	win.running = running
+}
+
+// Send pending items as a window, it waits until they are sent or the window is stopped
+func (win *window) Flush() {
+	win.mtxRun.Lock()
+	running := win.running
+	win.mtxRun.Unlock()
+	if !running {
+		return
+	}
+	var stop chan int
+	if win.sg != nil {
+		stop = win.sg.stop
+	}
+	done := make(chan int, 1)
+	select {
+	case win.flush <- done:
+		select {
+		case <-done:
+		case <-win.exited:
+		case <-stop:
+		}
+	case <-win.exited:
+	case <-stop:
+	}
+}
@@ -0,0 +1,138 @@
+package arch
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Run a model with a source of numbers from 1 to count, a window and a sink that collects windows
+func runWindow(t *testing.T, count int, newWindow func(in, out Pipe) Filter) []string {
+	nums := NewPipe("nums", int(0), 1)
+	windows := NewPipe("windows", int(0), 1)
+	n := 0
+	source := NewSourceFilter("nums", func() (int, bool) {
+		n++
+		return n, n <= count
+	}, WithPipes(nums))
+	mtx := sync.Mutex{}
+	collected := []string{}
+	sink := NewSinkFilter("collect", func(window []int) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		collected = append(collected, fmt.Sprint(window))
+	}, WithPipes(windows), WithLens(NewLen(windows, windows)))
+	model := NewModel(WithFilters(source, newWindow(nums, windows), sink), WithPipes(), WithPipes())
+	model.Run()
+	model.Wait()
+	mtx.Lock()
+	defer mtx.Unlock()
+	return collected
+}
+
+func TestCountWindow(t *testing.T) {
+	collected := runWindow(t, 10, func(in, out Pipe) Filter {
+		return NewCountWindow("count", in, out, 3)
+	})
+	if fmt.Sprint(collected) != "[[1 2 3] [4 5 6] [7 8 9] [10]]" {
+		t.Fatal(collected)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	collected := runWindow(t, 5, func(in, out Pipe) Filter {
+		return NewSlidingWindow("sliding", in, out, 3, 1)
+	})
+	if fmt.Sprint(collected) != "[[1 2 3] [2 3 4] [3 4 5]]" {
+		t.Fatal(collected)
+	}
+}
+
+func TestTimeWindowFlush(t *testing.T) {
+	input := NewPipe("input", "", 1)
+	windows := NewPipe("windows", "", 1)
+	window := NewTimeWindow("hourly", input, windows, time.Hour)
+	received := make(chan []string, 1)
+	sink := NewSinkFilter("collect", func(window []string) {
+		received <- window
+	}, WithPipes(windows), WithLens(NewLen(windows, windows)))
+	model := NewModel(WithFilters(window, sink), WithPipes(input), WithPipes())
+	model.Run()
+	for _, word := range []string{"a", "b", "c"} {
+		model.Call(WithInput(word))
+	}
+	model.Flush()
+	if words := <-received; fmt.Sprint(words) != "[a b c]" {
+		t.Fatal(words)
+	}
+	model.Stop()
+}
+
+func TestStopStuckWindow(t *testing.T) {
+	input := NewPipe("input", "", 1)
+	windows := NewPipe("windows", "", 0)
+	window := NewTimeWindow("hourly", input, windows, time.Hour)
+	stuck := make(chan int)
+	sink := NewSinkFilter("stuck", func(window []string) {
+		<-stuck
+	}, WithPipes(windows), WithLens(NewLen(windows, windows)))
+	model := NewModel(WithFilters(window, sink), WithPipes(input), WithPipes())
+	model.Run()
+	//The sink is stuck with the first window, so the window is stuck sending the second one
+	model.Call(WithInput("a"))
+	model.Flush()
+	model.Call(WithInput("b"))
+	go model.Flush()
+	stopped := make(chan int)
+	go func() {
+		model.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop waits for a window stuck sending")
+	}
+}
+
+func TestFlushWindowOfBusyInput(t *testing.T) {
+	nums := NewPipe("nums", int(0), 10)
+	windows := NewPipe("windows", int(0), 1)
+	window := NewTimeWindow("hourly", nums, windows, time.Hour)
+	sink := NewSinkFilter("drop", func(window []int) {}, WithPipes(windows), WithLens(NewLen(windows, windows)))
+	model := NewModel(WithFilters(window, sink), WithPipes(nums), WithPipes())
+	//Every item received by the window sends another one, so its input is never empty
+	producing := atomic.Bool{}
+	producing.Store(true)
+	received := make(chan int, 1)
+	window.SetHooks(Hooks{OnItemIn: func(filter, pipe string, seq uint64) {
+		if producing.Load() {
+			nums.Set(1)
+		}
+		select {
+		case received <- 0:
+		default:
+		}
+	}})
+	model.Run()
+	nums.Set(1)
+	<-received
+	flushed := make(chan int)
+	go func() {
+		model.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("flush waits for an input that keeps receiving items")
+	}
+	producing.Store(false)
+	start := time.Now()
+	model.Stop()
+	if stopped := time.Since(start); stopped >= stopFlushTimeout {
+		t.Fatal("stop waited for the flush timeout", stopped)
+	}
+}